@@ -0,0 +1,197 @@
+package Data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// CapitalLossCarryoverWorksheet is the IRS Capital Loss Carryover Worksheet from the Schedule D instructions for
+// TaxYear, worked from the prior year's return. All amounts are in cents and entered as positive numbers the way the
+// worksheet asks for them.
+type CapitalLossCarryoverWorksheet struct {
+	AccountId    int
+	TaxYear      int
+	FilingStatus string
+	// Line1 is the prior year's taxable income, which may be negative, or nil when it was not recorded. Without it the
+	// full deducted loss is assumed to have been used.
+	Line1 *int64
+	// Line2 is the loss deducted on the prior year's Schedule D line 21
+	Line2 int64
+	// Line3 is line 1 plus line 2, not less than zero
+	Line3 int64
+	// Line4 is the smaller of line 2 or line 3
+	Line4 int64
+	// Line5 is the loss on the prior year's Schedule D line 7, the net short-term result
+	Line5 int64
+	// Line6 is the gain on the prior year's Schedule D line 15, the net long-term result
+	Line6 int64
+	// Line7 is line 4 plus line 6
+	Line7 int64
+	// Line8 is the short-term capital loss carryover, line 5 less line 7
+	Line8 int64
+	// Line9 is the loss on the prior year's Schedule D line 15
+	Line9 int64
+	// Line10 is the gain on the prior year's Schedule D line 7
+	Line10 int64
+	// Line11 is line 7 less line 5
+	Line11 int64
+	// Line12 is line 10 plus line 11
+	Line12 int64
+	// Line13 is the long-term capital loss carryover, line 9 less line 12
+	Line13 int64
+}
+
+// GetFilingStatus returns the filing status the account's capital loss deduction is limited by, SINGLE unless the
+// account says otherwise
+func (db *DatabaseHelper) GetFilingStatus(accountNumber int) (string, error) {
+	filingStatus := "SINGLE"
+	query := "SELECT filing_status FROM account_info WHERE account_id=$1"
+	err := db.conn().QueryRow(query, accountNumber).Scan(&filingStatus)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("error querying filing status: %w", err)
+	}
+	return filingStatus, nil
+}
+
+// SetFilingStatus changes the filing status used for the account, one of SINGLE, MFJ, MFS, HOH or QSS
+func (db *DatabaseHelper) SetFilingStatus(accountNumber int, filingStatus string) error {
+	query := `
+        UPDATE account_info
+        SET filing_status = $2
+        WHERE account_id = $1
+    `
+	result, err := db.conn().Exec(query, accountNumber, filingStatus)
+	if err != nil {
+		return fmt.Errorf("error updating filing status: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("account %d not found", accountNumber)
+	}
+	return nil
+}
+
+// SetTaxableIncome records the taxable income reported for a tax year, in cents, for line 1 of the next year's
+// carryover worksheet
+func (db *DatabaseHelper) SetTaxableIncome(accountId int, taxYear int, amount int64) error {
+	query := `
+		INSERT INTO taxable_income (account_id, tax_year, amount)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (account_id, tax_year) DO UPDATE SET amount = EXCLUDED.amount
+	`
+	_, err := db.conn().Exec(query, accountId, taxYear, amount)
+	if err != nil {
+		return fmt.Errorf("error saving taxable income: %w", err)
+	}
+	return nil
+}
+
+// GetTaxableIncomes returns the taxable income recorded for each tax year of the account
+func (db *DatabaseHelper) GetTaxableIncomes(accountId int) (map[int]int64, error) {
+	rows, err := db.conn().Query("SELECT tax_year, amount FROM taxable_income WHERE account_id = $1", accountId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying taxable income: %w", err)
+	}
+	defer rows.Close()
+
+	incomes := make(map[int]int64)
+
+	for rows.Next() {
+		var taxYear int
+		var amount int64
+		if err := rows.Scan(&taxYear, &amount); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		incomes[taxYear] = amount
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return incomes, nil
+}
+
+// SetCapitalLossCarryover records the losses carried into a tax year and the loss deducted in it, adding a balance
+// row for a year without any realized gains
+func (db *DatabaseHelper) SetCapitalLossCarryover(accountId int, taxYear int, shortTermCarryover int64,
+	longTermCarryover int64, deductedLoss int64) error {
+	query := `
+		INSERT INTO capital_gains_balance (account_id, tax_year, net_capital_change, carryover_loss,
+		                                   short_term_carryover, long_term_carryover, deducted_loss)
+		VALUES ($1, $2, 0, $3 + $4, $3, $4, $5)
+		ON CONFLICT (account_id, tax_year) DO UPDATE
+		SET carryover_loss = EXCLUDED.carryover_loss, short_term_carryover = EXCLUDED.short_term_carryover,
+		    long_term_carryover = EXCLUDED.long_term_carryover, deducted_loss = EXCLUDED.deducted_loss
+	`
+	_, err := db.conn().Exec(query, accountId, taxYear, shortTermCarryover, longTermCarryover, deductedLoss)
+	if err != nil {
+		return fmt.Errorf("error saving capital loss carryover: %w", err)
+	}
+	return nil
+}
+
+// ReplaceCapitalLossCarryoverWorksheets swaps the account's stored worksheets for a freshly computed set
+func (db *DatabaseHelper) ReplaceCapitalLossCarryoverWorksheets(accountId int,
+	worksheets []CapitalLossCarryoverWorksheet) error {
+	_, err := db.conn().Exec("DELETE FROM capital_loss_carryover_worksheets WHERE account_id = $1", accountId)
+	if err != nil {
+		return fmt.Errorf("error clearing capital loss carryover worksheets: %w", err)
+	}
+
+	query := `
+		INSERT INTO capital_loss_carryover_worksheets (account_id, tax_year, filing_status, line_1, line_2, line_3,
+		                                               line_4, line_5, line_6, line_7, line_8, line_9, line_10,
+		                                               line_11, line_12, line_13)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`
+	for _, w := range worksheets {
+		_, err := db.conn().Exec(query, accountId, w.TaxYear, w.FilingStatus, w.Line1, w.Line2, w.Line3, w.Line4,
+			w.Line5, w.Line6, w.Line7, w.Line8, w.Line9, w.Line10, w.Line11, w.Line12, w.Line13)
+		if err != nil {
+			return fmt.Errorf("error inserting capital loss carryover worksheet: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetCapitalLossCarryoverWorksheets returns the account's stored worksheets, oldest tax year first
+func (db *DatabaseHelper) GetCapitalLossCarryoverWorksheets(accountId int) ([]CapitalLossCarryoverWorksheet, error) {
+	query := `
+		SELECT account_id, tax_year, filing_status, line_1, line_2, line_3, line_4, line_5, line_6, line_7, line_8,
+		       line_9, line_10, line_11, line_12, line_13
+		FROM capital_loss_carryover_worksheets
+		WHERE account_id = $1
+		ORDER BY tax_year
+	`
+
+	rows, err := db.conn().Query(query, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying capital loss carryover worksheets: %w", err)
+	}
+	defer rows.Close()
+
+	var worksheets []CapitalLossCarryoverWorksheet
+
+	for rows.Next() {
+		var w CapitalLossCarryoverWorksheet
+
+		err := rows.Scan(&w.AccountId, &w.TaxYear, &w.FilingStatus, &w.Line1, &w.Line2, &w.Line3, &w.Line4,
+			&w.Line5, &w.Line6, &w.Line7, &w.Line8, &w.Line9, &w.Line10, &w.Line11, &w.Line12, &w.Line13)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		worksheets = append(worksheets, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return worksheets, nil
+}
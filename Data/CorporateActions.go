@@ -0,0 +1,167 @@
+package Data
+
+import (
+	"fmt"
+	"time"
+)
+
+// CorporateAction is an event that changes the shares of a security for every holder, such as a stock split, ticker
+// change, merger or spin-off. Actions are recorded once and applied to each account's lots by the matcher in date
+// order with its transactions. The security is identified by Cusip when known, StockTicker otherwise.
+type CorporateAction struct {
+	ActionId      int64
+	ActionType    string
+	StockTicker   string
+	Cusip         string
+	EffectiveDate time.Time
+	// SplitFrom and SplitTo are the share ratio, e.g. 1 and 4 for a 4-for-1 split or 10 and 1 for a 1-for-10 reverse
+	// split. For mergers and spin-offs SplitTo new shares are received for every SplitFrom shares held.
+	SplitFrom int
+	SplitTo   int
+	// CashInLieuPrice is the per share price in cents paid for fractional shares left over, 0 if they are kept
+	CashInLieuPrice int64
+	// NewStockTicker and NewCusip are the security received in a ticker change, stock merger or spin-off
+	NewStockTicker string
+	NewCusip       string
+	// CashPerShare is the cash in cents received for every share held in a cash or cash and stock merger
+	CashPerShare int64
+	// NewStockPrice is the fair market value in cents of each new share received in a merger, which decides the gain
+	// of a taxable merger and how much of the cash paid alongside stock in a reorganization is taxed
+	NewStockPrice int64
+	// BasisAllocation is the millionths of the original basis given to the new security, e.g. 88352 for 8.8352% of
+	// the basis going to spun-off shares, as published on the issuer's Form 8937
+	BasisAllocation int64
+}
+
+const corporateActionColumns = `action_id, action_type, stock_ticker, COALESCE(cusip, ''), effective_date, split_from,
+		       split_to, cash_in_lieu_price, COALESCE(new_stock_ticker, ''), COALESCE(new_cusip, ''), cash_per_share,
+		       basis_allocation, new_stock_price`
+
+func scanCorporateAction(row rowScanner) (CorporateAction, error) {
+	var action CorporateAction
+	err := row.Scan(
+		&action.ActionId,
+		&action.ActionType,
+		&action.StockTicker,
+		&action.Cusip,
+		&action.EffectiveDate,
+		&action.SplitFrom,
+		&action.SplitTo,
+		&action.CashInLieuPrice,
+		&action.NewStockTicker,
+		&action.NewCusip,
+		&action.CashPerShare,
+		&action.BasisAllocation,
+		&action.NewStockPrice,
+	)
+	return action, err
+}
+
+// InsertCorporateAction records a corporate action and returns it with its generated id
+func (db *DatabaseHelper) InsertCorporateAction(action CorporateAction) (CorporateAction, error) {
+	query := `
+		INSERT INTO corporate_actions (action_type, stock_ticker, cusip, effective_date, split_from, split_to,
+		                               cash_in_lieu_price, new_stock_ticker, new_cusip, cash_per_share,
+		                               basis_allocation, new_stock_price)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), $10, $11, $12)
+		RETURNING action_id
+	`
+	err := db.conn().QueryRow(query, action.ActionType, action.StockTicker, action.Cusip, action.EffectiveDate,
+		action.SplitFrom, action.SplitTo, action.CashInLieuPrice, action.NewStockTicker, action.NewCusip,
+		action.CashPerShare, action.BasisAllocation, action.NewStockPrice).Scan(&action.ActionId)
+	if err != nil {
+		return CorporateAction{}, fmt.Errorf("error inserting corporate action: %w", err)
+	}
+	return action, nil
+}
+
+// GetPendingCorporateActions returns the actions effective on or before through that have not been applied to the
+// account yet, oldest first
+func (db *DatabaseHelper) GetPendingCorporateActions(accountId int, through time.Time) ([]CorporateAction, error) {
+	query := `
+		SELECT ` + corporateActionColumns + `
+		FROM corporate_actions c
+		WHERE effective_date <= $2
+		  AND NOT EXISTS (SELECT 1 FROM applied_corporate_actions a
+		                  WHERE a.account_id = $1 AND a.action_id = c.action_id)
+		ORDER BY effective_date, action_id
+	`
+
+	rows, err := db.conn().Query(query, accountId, through)
+	if err != nil {
+		return nil, fmt.Errorf("error querying corporate actions: %w", err)
+	}
+	defer rows.Close()
+
+	var actions []CorporateAction
+
+	for rows.Next() {
+		action, err := scanCorporateAction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		actions = append(actions, action)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return actions, nil
+}
+
+// MarkCorporateActionApplied records that the account's lots have been adjusted for the action
+func (db *DatabaseHelper) MarkCorporateActionApplied(accountId int, actionId int64) error {
+	query := `
+		INSERT INTO applied_corporate_actions (account_id, action_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := db.conn().Exec(query, accountId, actionId)
+	if err != nil {
+		return fmt.Errorf("error marking corporate action applied: %w", err)
+	}
+	return nil
+}
+
+// HasMatchedTransactionsAfter reports whether the account has already matched activity in the ticker after date,
+// which a newly recorded corporate action effective on date would have changed
+func (db *DatabaseHelper) HasMatchedTransactionsAfter(accountId int, stockTicker string, date time.Time) (bool,
+	error) {
+	var exists bool
+	query := `
+		SELECT EXISTS (SELECT 1 FROM transaction_history
+		               WHERE account_id = $1 AND stock_ticker = $2 AND activity_date >= $3 AND matched = true)
+	`
+	err := db.conn().QueryRow(query, accountId, stockTicker, date).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error querying transactions: %w", err)
+	}
+	return exists, nil
+}
+
+// GetAccountIDs returns every account known to the database
+func (db *DatabaseHelper) GetAccountIDs() ([]int, error) {
+	rows, err := db.conn().Query("SELECT account_id FROM account_info ORDER BY account_id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accountIds []int
+
+	for rows.Next() {
+		var accountId int
+		if err := rows.Scan(&accountId); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		accountIds = append(accountIds, accountId)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return accountIds, nil
+}
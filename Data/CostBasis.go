@@ -0,0 +1,172 @@
+package Data
+
+import (
+	"fmt"
+)
+
+// LotSelection is a user designated purchase and share count to sell under specific lot identification. Lots are
+// identified by the activity that opened them since lot ids change when gains are recomputed.
+type LotSelection struct {
+	AccountId      int
+	SellActivityId int64
+	LotActivityId  int64
+	Quantity       Quantity
+}
+
+// SetSaleCostBasisMethod overrides the account's cost basis method for a single sell activity
+func (db *DatabaseHelper) SetSaleCostBasisMethod(accountId int, sellActivityId int64, costBasisMethod string) error {
+	query := `
+		INSERT INTO sale_cost_basis_overrides (account_id, sell_activity_id, cost_basis_method)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (account_id, sell_activity_id) DO UPDATE SET cost_basis_method = EXCLUDED.cost_basis_method
+	`
+	_, err := db.conn().Exec(query, accountId, sellActivityId, costBasisMethod)
+	if err != nil {
+		return fmt.Errorf("error saving cost basis override: %w", err)
+	}
+	return nil
+}
+
+// GetSaleCostBasisOverrides returns every per sale cost basis method override for the account keyed by activity id
+func (db *DatabaseHelper) GetSaleCostBasisOverrides(accountId int) (map[int64]string, error) {
+	query := `
+		SELECT sell_activity_id, cost_basis_method
+		FROM sale_cost_basis_overrides
+		WHERE account_id = $1
+	`
+
+	rows, err := db.conn().Query(query, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying cost basis overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := make(map[int64]string)
+
+	for rows.Next() {
+		var sellActivityId int64
+		var costBasisMethod string
+		if err := rows.Scan(&sellActivityId, &costBasisMethod); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		overrides[sellActivityId] = costBasisMethod
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return overrides, nil
+}
+
+// AddSpecificLotSelection designates shares of a purchase to be sold by a sell activity matched with SPECIFIC_ID
+func (db *DatabaseHelper) AddSpecificLotSelection(selection LotSelection) error {
+	query := `
+		INSERT INTO specific_lot_selections (account_id, sell_activity_id, lot_activity_id, quantity)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id, sell_activity_id, lot_activity_id) DO UPDATE SET quantity = EXCLUDED.quantity
+	`
+	_, err := db.conn().Exec(query, selection.AccountId, selection.SellActivityId, selection.LotActivityId,
+		selection.Quantity)
+	if err != nil {
+		return fmt.Errorf("error saving lot selection: %w", err)
+	}
+	return nil
+}
+
+// GetSpecificLotSelections returns the lots designated for a sell activity in the order they were chosen
+func (db *DatabaseHelper) GetSpecificLotSelections(accountId int, sellActivityId int64) ([]LotSelection, error) {
+	query := `
+		SELECT account_id, sell_activity_id, lot_activity_id, quantity
+		FROM specific_lot_selections
+		WHERE account_id = $1 AND sell_activity_id = $2
+		ORDER BY lot_activity_id
+	`
+
+	rows, err := db.conn().Query(query, accountId, sellActivityId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying lot selections: %w", err)
+	}
+	defer rows.Close()
+
+	var selections []LotSelection
+
+	for rows.Next() {
+		var selection LotSelection
+
+		err := rows.Scan(
+			&selection.AccountId,
+			&selection.SellActivityId,
+			&selection.LotActivityId,
+			&selection.Quantity,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		selections = append(selections, selection)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return selections, nil
+}
+
+// CostBasisElection is a cost basis method elected for one security or for every security of an asset type in an
+// account. Scope is SECURITY with the ticker or CUSIP as ScopeValue, or ASSET_TYPE with a Schwab asset type such as
+// MUTUAL_FUND.
+type CostBasisElection struct {
+	AccountId       int
+	Scope           string
+	ScopeValue      string
+	CostBasisMethod string
+}
+
+// SetCostBasisElection records the cost basis method for a security or asset type, replacing any earlier election
+func (db *DatabaseHelper) SetCostBasisElection(election CostBasisElection) error {
+	query := `
+		INSERT INTO cost_basis_method_elections (account_id, scope, scope_value, cost_basis_method)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id, scope, scope_value) DO UPDATE SET cost_basis_method = EXCLUDED.cost_basis_method
+	`
+	_, err := db.conn().Exec(query, election.AccountId, election.Scope, election.ScopeValue,
+		election.CostBasisMethod)
+	if err != nil {
+		return fmt.Errorf("error saving cost basis election: %w", err)
+	}
+	return nil
+}
+
+// GetCostBasisElections returns every security and asset type cost basis election for the account
+func (db *DatabaseHelper) GetCostBasisElections(accountId int) ([]CostBasisElection, error) {
+	query := `
+		SELECT account_id, scope, scope_value, cost_basis_method
+		FROM cost_basis_method_elections
+		WHERE account_id = $1
+	`
+
+	rows, err := db.conn().Query(query, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying cost basis elections: %w", err)
+	}
+	defer rows.Close()
+
+	var elections []CostBasisElection
+
+	for rows.Next() {
+		var election CostBasisElection
+		err := rows.Scan(&election.AccountId, &election.Scope, &election.ScopeValue, &election.CostBasisMethod)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		elections = append(elections, election)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return elections, nil
+}
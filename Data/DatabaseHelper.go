@@ -8,6 +8,8 @@ import (
 	_ "github.com/jackc/pgx/v4/stdlib"
 	_ "github.com/lib/pq"
 	"log"
+	"log/slog"
+	"math"
 	"net/url"
 	"strings"
 	"time"
@@ -21,6 +23,14 @@ type DatabaseHelper struct {
 	Port             string
 	DatabaseName     string
 	Database         *sql.DB
+	tx               *sql.Tx
+}
+
+// dbConn is satisfied by both *sql.DB and *sql.Tx so every query can run inside a transaction when one is open
+type dbConn interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
 }
 
 func NewDatabaseHelperFromConnectionString(connStr string) (*DatabaseHelper, error) {
@@ -55,10 +65,44 @@ func NewDatabaseHelperFromConnectionString(connStr string) (*DatabaseHelper, err
 	}, nil
 }
 
+func (db *DatabaseHelper) conn() dbConn {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.Database
+}
+
+// Begin opens a transaction and returns a copy of the helper whose queries all run inside it until Commit or Rollback
+func (db *DatabaseHelper) Begin() (*DatabaseHelper, error) {
+	tx, err := db.Database.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	txHelper := *db
+	txHelper.tx = tx
+	return &txHelper, nil
+}
+
+// Commit commits the transaction opened by Begin
+func (db *DatabaseHelper) Commit() error {
+	if db.tx == nil {
+		return errors.New("no transaction to commit")
+	}
+	return db.tx.Commit()
+}
+
+// Rollback aborts the transaction opened by Begin
+func (db *DatabaseHelper) Rollback() error {
+	if db.tx == nil {
+		return errors.New("no transaction to roll back")
+	}
+	return db.tx.Rollback()
+}
+
 func (db *DatabaseHelper) GetHashedAccountNumber(accountNumber int) string {
 	var hashedAccountNumber string
 	query := "SELECT hash_id FROM account_info WHERE account_id=$1"
-	err := db.Database.QueryRow(query, accountNumber).Scan(&hashedAccountNumber)
+	err := db.conn().QueryRow(query, accountNumber).Scan(&hashedAccountNumber)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Fatal("Query failed: ", err)
 	}
@@ -70,7 +114,7 @@ func (db *DatabaseHelper) InsertHashedAccountNumber(accountNumber int, hashedAcc
         INSERT INTO account_info (account_id, hash_id) 
         VALUES ($1, $2)
     `
-	result, err := db.Database.Exec(query, accountNumber, hashedAccountNumber)
+	result, err := db.conn().Exec(query, accountNumber, hashedAccountNumber)
 	if err != nil {
 		log.Fatal("Query failed: ", err)
 	}
@@ -83,76 +127,262 @@ func (db *DatabaseHelper) InsertHashedAccountNumber(accountNumber int, hashedAcc
 	return hashedAccountNumber
 }
 
-func (db *DatabaseHelper) MatchTransactions(accountNumber int, matchedActivityIds []int64) int64 {
+// GetCostBasisMethod returns the cost basis method elected for the account, FIFO unless the account says otherwise
+func (db *DatabaseHelper) GetCostBasisMethod(accountNumber int) (string, error) {
+	costBasisMethod := "FIFO"
+	query := "SELECT cost_basis_method FROM account_info WHERE account_id=$1"
+	err := db.conn().QueryRow(query, accountNumber).Scan(&costBasisMethod)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("error querying cost basis method: %w", err)
+	}
+	return costBasisMethod, nil
+}
+
+// SetCostBasisMethod changes the default cost basis method used when matching the account's sales
+func (db *DatabaseHelper) SetCostBasisMethod(accountNumber int, costBasisMethod string) error {
+	query := `
+        UPDATE account_info
+        SET cost_basis_method = $2
+        WHERE account_id = $1
+    `
+	result, err := db.conn().Exec(query, accountNumber, costBasisMethod)
+	if err != nil {
+		return fmt.Errorf("error updating cost basis method: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("account %d not found", accountNumber)
+	}
+	return nil
+}
+
+// MatchTransactions flags the activities a matcher run consumed so later runs skip them
+func (db *DatabaseHelper) MatchTransactions(accountNumber int, matchedActivityIds []int64) (int64, error) {
 	query := `
         UPDATE transaction_history
         SET matched = true
         WHERE account_id = $1 AND activity_id = ANY($2)
     `
-	result, err := db.Database.Exec(query, accountNumber, matchedActivityIds)
+	result, err := db.conn().Exec(query, accountNumber, matchedActivityIds)
 	if err != nil {
-		log.Fatal("Query failed: ", err)
+		return 0, fmt.Errorf("error matching transactions: %w", err)
 	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 
 	fmt.Printf("Updated %d row(s) successfully.\n", rowsAffected)
-	return rowsAffected
+	return rowsAffected, nil
 }
 
-func (db *DatabaseHelper) UpsertCapitalGainsBalance(accountId int, taxYear int, netCapitalChange int64, carryover int) {
+// UpsertCapitalGainsBalance adds short and long term changes onto the account's balance for the tax year
+func (db *DatabaseHelper) UpsertCapitalGainsBalance(accountId int, taxYear int, shortTermChange int64,
+	longTermChange int64, carryover int) error {
 
-	query := `SELECT upsertcapitalchangebalance($1, $2, $3, $4)`
+	query := `SELECT upsertcapitalchangebalance($1, $2, $3, $4, $5)`
 
-	_, err := db.Database.Exec(query, accountId, taxYear, netCapitalChange, carryover)
+	_, err := db.conn().Exec(query, accountId, taxYear, shortTermChange, longTermChange, carryover)
 	if err != nil {
-		log.Fatal("Query failed: ", err)
+		return fmt.Errorf("error saving capital gains balance: %w", err)
 	}
+	return nil
+}
+
+// RecordImportedCapitalGains adds short and long term changes imported from a 1099 onto the account's imported figures
+// for the tax year, which ClearDerivedState keeps when the account is recomputed
+func (db *DatabaseHelper) RecordImportedCapitalGains(accountId int, taxYear int, shortTermChange int64,
+	longTermChange int64) error {
+
+	query := `INSERT INTO imported_capital_gains (account_id, tax_year, short_term_change, long_term_change)
+              VALUES ($1, $2, $3, $4)
+              ON CONFLICT (account_id, tax_year) DO UPDATE
+              SET short_term_change = imported_capital_gains.short_term_change + EXCLUDED.short_term_change,
+                  long_term_change = imported_capital_gains.long_term_change + EXCLUDED.long_term_change`
+
+	_, err := db.conn().Exec(query, accountId, taxYear, shortTermChange, longTermChange)
+	if err != nil {
+		return fmt.Errorf("error saving imported capital gains: %w", err)
+	}
+	return nil
 }
 
 func (db *DatabaseHelper) GetCapitalGainsBalanceForYear(accountId int, taxYear int) int64 {
 
 	var netCapitalChange int64
 	query := "SELECT net_capital_change FROM capital_gains_balance WHERE account_id=$1 and tax_year=$2"
-	err := db.Database.QueryRow(query, accountId, taxYear).Scan(&netCapitalChange)
+	err := db.conn().QueryRow(query, accountId, taxYear).Scan(&netCapitalChange)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Fatal("Query failed: ", err)
 	}
 	return netCapitalChange
 }
 
+type CapitalGainsBalance struct {
+	AccountId        int
+	TaxYear          int
+	ShortTermChange  int64
+	LongTermChange   int64
+	NetCapitalChange int64
+	// CarryoverLoss is the total capital loss carried into the year, ShortTermCarryover plus LongTermCarryover
+	CarryoverLoss      int64
+	ShortTermCarryover int64
+	LongTermCarryover  int64
+	// DeductedLoss is the net capital loss deducted against ordinary income for the year, at most $3,000
+	DeductedLoss int64
+	// OrdinaryGain is the gain or loss from positions marked to market, which is ordinary income and not part of
+	// NetCapitalChange
+	OrdinaryGain int64
+}
+
+// GetCapitalGainsBalanceDetailForYear returns the account's balance for the tax year split into short and long term
+func (db *DatabaseHelper) GetCapitalGainsBalanceDetailForYear(accountId int, taxYear int) CapitalGainsBalance {
+	balance := CapitalGainsBalance{AccountId: accountId, TaxYear: taxYear}
+	query := `
+		SELECT short_term_change, long_term_change, net_capital_change, carryover_loss, short_term_carryover,
+		       long_term_carryover, deducted_loss, ordinary_gain
+		FROM capital_gains_balance
+		WHERE account_id=$1 and tax_year=$2
+	`
+	err := db.conn().QueryRow(query, accountId, taxYear).Scan(
+		&balance.ShortTermChange,
+		&balance.LongTermChange,
+		&balance.NetCapitalChange,
+		&balance.CarryoverLoss,
+		&balance.ShortTermCarryover,
+		&balance.LongTermCarryover,
+		&balance.DeductedLoss,
+		&balance.OrdinaryGain,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Fatal("Query failed: ", err)
+	}
+	return balance
+}
+
+// GetCapitalGainsBalancesByAccountID returns the account's balance for every tax year, oldest first
+func (db *DatabaseHelper) GetCapitalGainsBalancesByAccountID(accountId int) ([]CapitalGainsBalance, error) {
+	query := `
+		SELECT account_id, tax_year, short_term_change, long_term_change, net_capital_change, carryover_loss,
+		       short_term_carryover, long_term_carryover, deducted_loss, ordinary_gain
+		FROM capital_gains_balance
+		WHERE account_id = $1
+		ORDER BY tax_year
+	`
+
+	rows, err := db.conn().Query(query, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying capital gains balances: %w", err)
+	}
+	defer rows.Close()
+
+	var balances []CapitalGainsBalance
+
+	for rows.Next() {
+		var balance CapitalGainsBalance
+
+		err := rows.Scan(
+			&balance.AccountId,
+			&balance.TaxYear,
+			&balance.ShortTermChange,
+			&balance.LongTermChange,
+			&balance.NetCapitalChange,
+			&balance.CarryoverLoss,
+			&balance.ShortTermCarryover,
+			&balance.LongTermCarryover,
+			&balance.DeductedLoss,
+			&balance.OrdinaryGain,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		balances = append(balances, balance)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return balances, nil
+}
+
+// ClearDerivedState deletes every lot, ledger row and balance computed for the account and marks its transactions
+// unmatched so they can be replayed from scratch. Balances are reset to the figures imported from 1099s, which the
+// transaction history can't rebuild.
+func (db *DatabaseHelper) ClearDerivedState(accountId int) error {
+	queries := []string{
+		"DELETE FROM realized_gains WHERE account_id = $1",
+		"DELETE FROM tax_lots WHERE account_id = $1",
+		"DELETE FROM capital_gains_balance WHERE account_id = $1",
+		`INSERT INTO capital_gains_balance (account_id, tax_year, net_capital_change, carryover_loss,
+                                           short_term_change, long_term_change)
+         SELECT account_id, tax_year, short_term_change + long_term_change, 0, short_term_change, long_term_change
+         FROM imported_capital_gains WHERE account_id = $1`,
+		"DELETE FROM capital_loss_carryover_worksheets WHERE account_id = $1",
+		"DELETE FROM applied_corporate_actions WHERE account_id = $1",
+		"DELETE FROM mark_to_market_years WHERE account_id = $1",
+		"UPDATE transaction_history SET matched = false WHERE account_id = $1",
+	}
+	for _, query := range queries {
+		if _, err := db.conn().Exec(query, accountId); err != nil {
+			return fmt.Errorf("error clearing derived state: %w", err)
+		}
+	}
+	return nil
+}
+
+// InsertTransactionData records every execution leg of the filled orders as its own transaction_history row, keyed by
+// the activity and the leg it filled. Each row carries the instrument and instruction of its order leg and the
+// quantity, price and time of the execution, so multi-leg orders and activities filled across several legs keep
+// every leg and price. Legs already recorded are skipped, and a leg that fails to insert is logged and skipped.
 func (db *DatabaseHelper) InsertTransactionData(orders []JsonParser.Order) int64 {
 	var rowsAffected int64
 	for _, order := range orders {
-		orderLeg := order.OrderLegCollection[0]
-		if order.Status == "FILLED" && orderLeg.OrderLegType != "OPTION" {
+		if order.Status == "FILLED" {
+			orderLegs := make(map[int64]JsonParser.OrderLeg)
+			for _, orderLeg := range order.OrderLegCollection {
+				orderLegs[int64(orderLeg.LegId)] = orderLeg
+			}
 			for _, activity := range order.OrderActivityCollection {
-				activityId := activity.ActivityId
-				activityType := orderLeg.Instruction
-				shareCount := activity.Quantity
-				stockPrice := int64(activity.ExecutionLegs[0].Price * 100)
-				stockTicker := orderLeg.Instrument.Symbol
-				activityDate := activity.ExecutionLegs[0].Time
-
-				// Prepare the INSERT statement
-				query := `
-				INSERT INTO transaction_history (account_id, order_id, activity_id, stock_ticker, share_count, 
-				                                 stock_price, order_type, activity_date, matched) 
-				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-				`
-
-				result, err := db.Database.Exec(query, order.AccountNumber, order.OrderId, activityId, stockTicker,
-					int(shareCount), stockPrice, activityType, activityDate, false)
-				if err != nil {
-					//slog.Error("Query failed: ", err)
-					return 0
-				}
-				rowInserted, err := result.RowsAffected()
-				if err != nil {
+				for _, executionLeg := range activity.ExecutionLegs {
+					orderLeg, ok := orderLegs[executionLeg.LegId]
+					if !ok {
+						slog.Warn("Execution leg has no matching order leg", "orderId", order.OrderId,
+							"activityId", activity.ActivityId, "legId", executionLeg.LegId)
+						continue
+					}
+
+					// Prepare the INSERT statement
+					query := `
+					INSERT INTO transaction_history (account_id, order_id, activity_id, leg_id, stock_ticker, 
+					                                 share_count, stock_price, order_type, activity_date, matched,
+					                                 cusip, asset_type, instrument_id, position_effect) 
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), NULLIF($12, ''),
+					        NULLIF($13, 0), NULLIF($14, ''))
+					ON CONFLICT DO NOTHING
+					`
+
+					result, err := db.conn().Exec(query, order.AccountNumber, order.OrderId, activity.ActivityId,
+						executionLeg.LegId, orderLeg.Instrument.Symbol, QuantityFromFloat(executionLeg.Quantity),
+						int64(math.Round(executionLeg.Price*100)), orderLeg.Instruction, executionLeg.Time, false,
+						orderLeg.Instrument.Cusip, orderLeg.Instrument.AssetType, orderLeg.Instrument.InstrumentId,
+						orderLeg.PositionEffect)
+					if err != nil {
+						slog.Error("Error inserting execution leg", "orderId", order.OrderId,
+							"activityId", activity.ActivityId, "legId", executionLeg.LegId, "error", err)
+						continue
+					}
+					rowInserted, err := result.RowsAffected()
+					if err != nil {
+						slog.Error("Error counting inserted rows", "orderId", order.OrderId, "error", err)
+						continue
+					}
+					rowsAffected += rowInserted
 				}
-				rowsAffected += rowInserted
 			}
 		}
 	}
@@ -161,26 +391,63 @@ func (db *DatabaseHelper) InsertTransactionData(orders []JsonParser.Order) int64
 	return rowsAffected
 }
 
+// InsertManualTransaction records a transaction that did not come from a Schwab order, such as an option expiring
+// worthless. Transactions without an activity id are given a negative one from manual_activity_id_seq. The activity
+// id the transaction was stored under is returned.
+func (db *DatabaseHelper) InsertManualTransaction(transaction TransactionData) (int64, error) {
+	query := `
+		INSERT INTO transaction_history (account_id, order_id, activity_id, stock_ticker, share_count, stock_price,
+		                                 order_type, activity_date, matched, cusip)
+		VALUES ($1, $2, COALESCE(NULLIF($3, 0), -nextval('manual_activity_id_seq')), $4, $5, $6, $7, $8, false,
+		        NULLIF($9, ''))
+		RETURNING activity_id
+	`
+	var activityId int64
+	err := db.conn().QueryRow(query, transaction.AccountId, transaction.OrderId, transaction.ActivityId,
+		transaction.StockTicker, transaction.ShareCount, transaction.StockPrice, transaction.OrderType,
+		transaction.ActivityDate, transaction.Cusip).Scan(&activityId)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting transaction: %w", err)
+	}
+	return activityId, nil
+}
+
 type TransactionData struct {
-	AccountId    int
-	OrderId      int64
-	ActivityId   int64
+	AccountId  int
+	OrderId    int64
+	ActivityId int64
+	// LegId is the order leg the execution filled, 1 for single leg orders and manual transactions
+	LegId        int
 	StockTicker  string
-	ShareCount   int
+	ShareCount   Quantity
 	StockPrice   int64
 	OrderType    string
 	ActivityDate time.Time
 	Matched      bool
+	// Fees is the total commissions and regulatory fees charged on the execution, in cents
+	Fees int64
+	// Cusip identifies the security independently of ticker changes, empty when Schwab did not report one
+	Cusip string
+	// AssetType is the Schwab asset type of the instrument, e.g. EQUITY or MUTUAL_FUND, empty when not reported
+	AssetType string
 }
 
+// transactionFeesColumn sums the fees recorded for a transaction_history row aliased as t
+const transactionFeesColumn = `COALESCE((SELECT SUM(f.amount) FROM transaction_fees f
+		                WHERE f.account_id = t.account_id AND f.activity_id = t.activity_id
+		                  AND f.leg_id = t.leg_id), 0)`
+
 func (db *DatabaseHelper) GetTransactionsByAccountID(accountId int) ([]TransactionData, error) {
 	query := `
-		SELECT account_id, order_id, activity_id, stock_ticker, share_count, stock_price, order_type, activity_date, matched 
-		FROM transaction_history
+		SELECT account_id, order_id, activity_id, leg_id, stock_ticker, share_count, stock_price, order_type,
+		       activity_date, matched, ` + transactionFeesColumn + `, COALESCE(cusip, ''),
+		       COALESCE(asset_type, '')
+		FROM transaction_history t
 		WHERE account_id = $1
+		ORDER BY activity_date, activity_id, leg_id
 	`
 
-	rows, err := db.Database.Query(query, accountId)
+	rows, err := db.conn().Query(query, accountId)
 	if err != nil {
 		return nil, fmt.Errorf("error querying transactions: %w", err)
 	}
@@ -195,11 +462,16 @@ func (db *DatabaseHelper) GetTransactionsByAccountID(accountId int) ([]Transacti
 			&transaction.AccountId,
 			&transaction.OrderId,
 			&transaction.ActivityId,
+			&transaction.LegId,
 			&transaction.StockTicker,
 			&transaction.ShareCount,
 			&transaction.StockPrice,
 			&transaction.OrderType,
 			&transaction.ActivityDate,
+			&transaction.Matched,
+			&transaction.Fees,
+			&transaction.Cusip,
+			&transaction.AssetType,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %w", err)
@@ -217,12 +489,14 @@ func (db *DatabaseHelper) GetTransactionsByAccountID(accountId int) ([]Transacti
 
 func (db *DatabaseHelper) GetUnmatchedTransactionsByAccountID(accountId int) ([]TransactionData, error) {
 	query := `
-		SELECT account_id, order_id, activity_id, stock_ticker, share_count, stock_price, order_type, activity_date, matched
-		FROM transaction_history
+		SELECT account_id, order_id, activity_id, leg_id, stock_ticker, share_count, stock_price, order_type,
+		       activity_date, matched, ` + transactionFeesColumn + `, COALESCE(cusip, ''),
+		       COALESCE(asset_type, '')
+		FROM transaction_history t
 		WHERE account_id = $1 and matched = false
 	`
 
-	rows, err := db.Database.Query(query, accountId)
+	rows, err := db.conn().Query(query, accountId)
 	if err != nil {
 		return nil, fmt.Errorf("error querying transactions: %w", err)
 	}
@@ -237,12 +511,16 @@ func (db *DatabaseHelper) GetUnmatchedTransactionsByAccountID(accountId int) ([]
 			&transaction.AccountId,
 			&transaction.OrderId,
 			&transaction.ActivityId,
+			&transaction.LegId,
 			&transaction.StockTicker,
 			&transaction.ShareCount,
 			&transaction.StockPrice,
 			&transaction.OrderType,
 			&transaction.ActivityDate,
 			&transaction.Matched,
+			&transaction.Fees,
+			&transaction.Cusip,
+			&transaction.AssetType,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %w", err)
@@ -0,0 +1,143 @@
+package Data
+
+import (
+	"fmt"
+	"time"
+)
+
+// Dividend is a dividend paid on a position. Reinvested dividends also buy ReinvestedQuantity shares at
+// ReinvestPrice, which are recorded as a REINVEST transaction under the same activity id.
+type Dividend struct {
+	AccountId   int
+	ActivityId  int64
+	StockTicker string
+	Cusip       string
+	PayDate     time.Time
+	// Amount is the dividend in cents
+	Amount int64
+	// DividendType is QUALIFIED or ORDINARY
+	DividendType       string
+	ReinvestedQuantity Quantity
+	// ReinvestPrice is the per share price in cents the reinvested shares were bought at
+	ReinvestPrice int64
+}
+
+// DividendTotals is the dividend income of an account for one tax year
+type DividendTotals struct {
+	TaxYear   int
+	Qualified int64
+	Ordinary  int64
+}
+
+// InsertDividend records a dividend and returns it with its activity id, which is taken from manual_activity_id_seq
+// when the dividend has none. The returned flag is false when the dividend was already recorded.
+func (db *DatabaseHelper) InsertDividend(dividend Dividend) (Dividend, bool, error) {
+	query := `
+		INSERT INTO dividends (account_id, activity_id, stock_ticker, cusip, pay_date, amount, dividend_type,
+		                       reinvested_quantity, reinvest_price)
+		VALUES ($1, COALESCE(NULLIF($2, 0), -nextval('manual_activity_id_seq')), $3, NULLIF($4, ''), $5, $6, $7, $8,
+		        $9)
+		ON CONFLICT (account_id, activity_id) DO NOTHING
+		RETURNING activity_id
+	`
+	rows, err := db.conn().Query(query, dividend.AccountId, dividend.ActivityId, dividend.StockTicker,
+		dividend.Cusip, dividend.PayDate, dividend.Amount, dividend.DividendType, dividend.ReinvestedQuantity,
+		dividend.ReinvestPrice)
+	if err != nil {
+		return Dividend{}, false, fmt.Errorf("error inserting dividend: %w", err)
+	}
+	defer rows.Close()
+
+	inserted := rows.Next()
+	if inserted {
+		if err := rows.Scan(&dividend.ActivityId); err != nil {
+			return Dividend{}, false, fmt.Errorf("error scanning row: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Dividend{}, false, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return dividend, inserted, nil
+}
+
+// GetDividendsByAccountID returns every dividend paid to the account, oldest first
+func (db *DatabaseHelper) GetDividendsByAccountID(accountId int) ([]Dividend, error) {
+	query := `
+		SELECT account_id, activity_id, stock_ticker, COALESCE(cusip, ''), pay_date, amount, dividend_type,
+		       reinvested_quantity, reinvest_price
+		FROM dividends
+		WHERE account_id = $1
+		ORDER BY pay_date, activity_id
+	`
+
+	rows, err := db.conn().Query(query, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying dividends: %w", err)
+	}
+	defer rows.Close()
+
+	var dividends []Dividend
+
+	for rows.Next() {
+		var dividend Dividend
+
+		err := rows.Scan(
+			&dividend.AccountId,
+			&dividend.ActivityId,
+			&dividend.StockTicker,
+			&dividend.Cusip,
+			&dividend.PayDate,
+			&dividend.Amount,
+			&dividend.DividendType,
+			&dividend.ReinvestedQuantity,
+			&dividend.ReinvestPrice,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		dividends = append(dividends, dividend)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return dividends, nil
+}
+
+// GetDividendTotalsByAccountID returns the account's qualified and ordinary dividend income for every tax year it
+// was paid dividends, going by the pay date in US Eastern time
+func (db *DatabaseHelper) GetDividendTotalsByAccountID(accountId int) ([]DividendTotals, error) {
+	query := `
+		SELECT EXTRACT(YEAR FROM pay_date AT TIME ZONE 'UTC' AT TIME ZONE 'America/New_York')::INT AS tax_year,
+		       COALESCE(SUM(amount) FILTER (WHERE dividend_type = 'QUALIFIED'), 0),
+		       COALESCE(SUM(amount) FILTER (WHERE dividend_type = 'ORDINARY'), 0)
+		FROM dividends
+		WHERE account_id = $1
+		GROUP BY tax_year
+		ORDER BY tax_year
+	`
+
+	rows, err := db.conn().Query(query, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying dividend totals: %w", err)
+	}
+	defer rows.Close()
+
+	var totals []DividendTotals
+
+	for rows.Next() {
+		var total DividendTotals
+		if err := rows.Scan(&total.TaxYear, &total.Qualified, &total.Ordinary); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		totals = append(totals, total)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return totals, nil
+}
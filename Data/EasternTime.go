@@ -0,0 +1,20 @@
+package Data
+
+import (
+	"log"
+	"time"
+	_ "time/tzdata"
+)
+
+// EasternTime is the time zone of the US exchanges. Trade dates, and so tax years, holding periods and wash sale
+// windows, are taken in it, so a fill at 7pm ET on December 31st belongs to that year even though it is already
+// January 1st in UTC. The regular session of a trading day closes at 4pm in it.
+var EasternTime = loadEasternTime()
+
+func loadEasternTime() *time.Location {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return location
+}
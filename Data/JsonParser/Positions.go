@@ -0,0 +1,65 @@
+package JsonParser
+
+import "encoding/json"
+
+// AccountPositions is the response of the account endpoint with fields=positions
+type AccountPositions struct {
+	SecuritiesAccount SecuritiesAccount `json:"securitiesAccount"`
+}
+
+// SecuritiesAccount is an account and the positions Schwab holds in it
+type SecuritiesAccount struct {
+	Type          string     `json:"type"`
+	AccountNumber string     `json:"accountNumber"`
+	Positions     []Position `json:"positions"`
+}
+
+// Position is Schwab's view of the holding of a single instrument. Prices are per share, and option quantities count
+// contracts.
+type Position struct {
+	ShortQuantity           float64    `json:"shortQuantity"`
+	LongQuantity            float64    `json:"longQuantity"`
+	SettledLongQuantity     float64    `json:"settledLongQuantity"`
+	SettledShortQuantity    float64    `json:"settledShortQuantity"`
+	AveragePrice            float64    `json:"averagePrice"`
+	AverageLongPrice        float64    `json:"averageLongPrice"`
+	AverageShortPrice       float64    `json:"averageShortPrice"`
+	TaxLotAverageLongPrice  float64    `json:"taxLotAverageLongPrice"`
+	TaxLotAverageShortPrice float64    `json:"taxLotAverageShortPrice"`
+	MarketValue             float64    `json:"marketValue"`
+	LongOpenProfitLoss      float64    `json:"longOpenProfitLoss"`
+	ShortOpenProfitLoss     float64    `json:"shortOpenProfitLoss"`
+	Instrument              Instrument `json:"instrument"`
+}
+
+// ParsePositions decodes the positions out of an account endpoint response
+func ParsePositions(data []byte) ([]Position, error) {
+	var account AccountPositions
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, err
+	}
+	return account.SecuritiesAccount.Positions, nil
+}
+
+// LongAveragePrice returns the per share cost of the long quantity, preferring the tax lot average that includes
+// adjustments made to the lots
+func (p Position) LongAveragePrice() float64 {
+	if p.TaxLotAverageLongPrice != 0 {
+		return p.TaxLotAverageLongPrice
+	}
+	if p.AverageLongPrice != 0 {
+		return p.AverageLongPrice
+	}
+	return p.AveragePrice
+}
+
+// ShortAveragePrice returns the per share proceeds of the short quantity, preferring the tax lot average
+func (p Position) ShortAveragePrice() float64 {
+	if p.TaxLotAverageShortPrice != 0 {
+		return p.TaxLotAverageShortPrice
+	}
+	if p.AverageShortPrice != 0 {
+		return p.AverageShortPrice
+	}
+	return p.AveragePrice
+}
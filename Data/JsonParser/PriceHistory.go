@@ -0,0 +1,37 @@
+package JsonParser
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PriceHistory is the candles of a symbol returned by the price history endpoint
+type PriceHistory struct {
+	Symbol  string   `json:"symbol"`
+	Empty   bool     `json:"empty"`
+	Candles []Candle `json:"candles"`
+}
+
+// Candle is the prices of a symbol over one period, in dollars. Datetime is the start of the period in milliseconds
+// since the epoch.
+type Candle struct {
+	Open     float64 `json:"open"`
+	High     float64 `json:"high"`
+	Low      float64 `json:"low"`
+	Close    float64 `json:"close"`
+	Volume   int64   `json:"volume"`
+	Datetime int64   `json:"datetime"`
+}
+
+func ParsePriceHistory(data []byte) (PriceHistory, error) {
+	var history PriceHistory
+	err := json.Unmarshal(data, &history)
+	return history, err
+}
+
+// TradeDate returns the trading day of a daily candle as midnight UTC. Schwab stamps daily candles at midnight Central
+// time, which is still the same calendar day in UTC.
+func (c Candle) TradeDate() time.Time {
+	year, month, day := time.UnixMilli(c.Datetime).UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
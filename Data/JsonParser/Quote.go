@@ -0,0 +1,55 @@
+package JsonParser
+
+import "encoding/json"
+
+// Quote is the market data quote of a single symbol
+type Quote struct {
+	AssetMainType string      `json:"assetMainType"`
+	Symbol        string      `json:"symbol"`
+	QuoteType     string      `json:"quoteType"`
+	Realtime      bool        `json:"realtime"`
+	Quote         QuoteDetail `json:"quote"`
+}
+
+// QuoteDetail holds the prices of a quote in dollars. Times are in milliseconds since the epoch.
+type QuoteDetail struct {
+	LastPrice  float64 `json:"lastPrice"`
+	ClosePrice float64 `json:"closePrice"`
+	Mark       float64 `json:"mark"`
+	BidPrice   float64 `json:"bidPrice"`
+	AskPrice   float64 `json:"askPrice"`
+	QuoteTime  int64   `json:"quoteTime"`
+	TradeTime  int64   `json:"tradeTime"`
+}
+
+// ParseQuotes decodes a quotes response into quotes keyed by symbol. Symbols Schwab could not quote are reported
+// under an errors key, which is left out.
+func ParseQuotes(data []byte) (map[string]Quote, error) {
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	quotes := make(map[string]Quote, len(entries))
+	for symbol, entry := range entries {
+		if symbol == "errors" {
+			continue
+		}
+		var quote Quote
+		if err := json.Unmarshal(entry, &quote); err != nil {
+			return nil, err
+		}
+		quotes[symbol] = quote
+	}
+	return quotes, nil
+}
+
+// Price returns the price a position is valued at, the mark when there is one, else the last trade or the close
+func (q Quote) Price() float64 {
+	switch {
+	case q.Quote.Mark != 0:
+		return q.Quote.Mark
+	case q.Quote.LastPrice != 0:
+		return q.Quote.LastPrice
+	}
+	return q.Quote.ClosePrice
+}
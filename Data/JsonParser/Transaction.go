@@ -0,0 +1,97 @@
+package JsonParser
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Transaction types returned by the transactions endpoint that the project reads
+const (
+	TradeTransaction              = "TRADE"
+	DividendOrInterestTransaction = "DIVIDEND_OR_INTEREST"
+	ReceiveAndDeliverTransaction  = "RECEIVE_AND_DELIVER"
+	JournalTransaction            = "JOURNAL"
+)
+
+// TransactionTimeLayout is the layout of the times in a transaction, e.g. 2024-03-28T21:10:42+0000
+const TransactionTimeLayout = "2006-01-02T15:04:05-0700"
+
+// Transaction is a single account activity from the transactions endpoint. Unlike an order it also covers dividends,
+// journals and securities received or delivered without a trade.
+type Transaction struct {
+	ActivityId     int64          `json:"activityId"`
+	Time           string         `json:"time"`
+	Description    string         `json:"description"`
+	AccountNumber  string         `json:"accountNumber"`
+	Type           string         `json:"type"`
+	Status         string         `json:"status"`
+	SubAccount     string         `json:"subAccount"`
+	TradeDate      string         `json:"tradeDate"`
+	SettlementDate string         `json:"settlementDate"`
+	PositionId     int64          `json:"positionId"`
+	OrderId        int64          `json:"orderId"`
+	NetAmount      float64        `json:"netAmount"`
+	ActivityType   string         `json:"activityType"`
+	TransferItems  []TransferItem `json:"transferItems"`
+}
+
+// TransferItem is a movement of a security or cash within a transaction. Fees are cash items with a FeeType.
+type TransferItem struct {
+	Instrument     TransactionInstrument `json:"instrument"`
+	Amount         float64               `json:"amount"`
+	Cost           float64               `json:"cost"`
+	Price          float64               `json:"price"`
+	FeeType        string                `json:"feeType"`
+	PositionEffect string                `json:"positionEffect"`
+}
+
+// TransactionInstrument is the security or currency a transfer item moves
+type TransactionInstrument struct {
+	AssetType        string  `json:"assetType"`
+	Symbol           string  `json:"symbol"`
+	Cusip            string  `json:"cusip"`
+	InstrumentId     int64   `json:"instrumentId"`
+	Description      string  `json:"description"`
+	ClosingPrice     float64 `json:"closingPrice"`
+	PutCall          string  `json:"putCall"`
+	UnderlyingSymbol string  `json:"underlyingSymbol"`
+}
+
+// ParseTransactions decodes a transactions endpoint response
+func ParseTransactions(data []byte) ([]Transaction, error) {
+	var transactions []Transaction
+	if err := json.Unmarshal(data, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// Securities returns the transfer items that move a security rather than cash
+func (t Transaction) Securities() []TransferItem {
+	var items []TransferItem
+	for _, item := range t.TransferItems {
+		if item.Instrument.AssetType != "CURRENCY" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Fees returns the transfer items that charge a fee
+func (t Transaction) Fees() []TransferItem {
+	var items []TransferItem
+	for _, item := range t.TransferItems {
+		if item.Instrument.AssetType == "CURRENCY" && item.FeeType != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// TradeTime returns when the transaction took place, its trade date if it has one
+func (t Transaction) TradeTime() (time.Time, error) {
+	if t.TradeDate != "" {
+		return time.Parse(TransactionTimeLayout, t.TradeDate)
+	}
+	return time.Parse(TransactionTimeLayout, t.Time)
+}
@@ -0,0 +1,105 @@
+package Data
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ManualLot is a lot entered by hand for shares that were not bought through a Schwab order, e.g. a position
+// transferred in through ACATS. It is replayed as a TRANSFER_IN transaction with the same activity id.
+type ManualLot struct {
+	AccountId       int
+	ActivityId      int64
+	StockTicker     string
+	Cusip           string
+	Quantity        Quantity
+	AcquisitionDate time.Time
+	// TotalBasis is the cost basis of all the shares in cents
+	TotalBasis int64
+	// BasisUnknown is set when the transferring broker did not report the basis
+	BasisUnknown bool
+	// AcquisitionType is PURCHASE, GIFT or INHERITANCE. Gifted shares carry over the donor's basis, inherited shares
+	// have the fair market value on the date of death as TotalBasis and that date as AcquisitionDate.
+	AcquisitionType string
+	// DonorAcquisitionDate is when the donor acquired gifted shares, tacked on as their holding period
+	DonorAcquisitionDate time.Time
+	// FairMarketValue is the value in cents of all the gifted shares on the date of the gift, 0 if not recorded
+	FairMarketValue int64
+}
+
+// InsertManualLot records a manually entered lot and returns it with its activity id, taken from
+// manual_activity_id_seq when the lot has none
+func (db *DatabaseHelper) InsertManualLot(lot ManualLot) (ManualLot, error) {
+	if lot.AcquisitionType == "" {
+		lot.AcquisitionType = "PURCHASE"
+	}
+	var donorAcquisitionDate *time.Time
+	if !lot.DonorAcquisitionDate.IsZero() {
+		donorAcquisitionDate = &lot.DonorAcquisitionDate
+	}
+	query := `
+		INSERT INTO manual_lots (account_id, activity_id, stock_ticker, cusip, quantity, acquisition_date,
+		                         total_basis, basis_unknown, acquisition_type, donor_acquisition_date,
+		                         fair_market_value)
+		VALUES ($1, COALESCE(NULLIF($2, 0), -nextval('manual_activity_id_seq')), $3, NULLIF($4, ''), $5, $6, $7, $8,
+		        $9, $10, $11)
+		RETURNING activity_id
+	`
+	err := db.conn().QueryRow(query, lot.AccountId, lot.ActivityId, lot.StockTicker, lot.Cusip, lot.Quantity,
+		lot.AcquisitionDate, lot.TotalBasis, lot.BasisUnknown, lot.AcquisitionType, donorAcquisitionDate,
+		lot.FairMarketValue).Scan(&lot.ActivityId)
+	if err != nil {
+		return ManualLot{}, fmt.Errorf("error inserting manual lot: %w", err)
+	}
+	return lot, nil
+}
+
+// GetManualLotsByAccountID returns the account's manually entered lots keyed by activity id
+func (db *DatabaseHelper) GetManualLotsByAccountID(accountId int) (map[int64]ManualLot, error) {
+	query := `
+		SELECT account_id, activity_id, stock_ticker, COALESCE(cusip, ''), quantity, acquisition_date, total_basis,
+		       basis_unknown, acquisition_type, donor_acquisition_date, fair_market_value
+		FROM manual_lots
+		WHERE account_id = $1
+	`
+
+	rows, err := db.conn().Query(query, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying manual lots: %w", err)
+	}
+	defer rows.Close()
+
+	lots := make(map[int64]ManualLot)
+
+	for rows.Next() {
+		var lot ManualLot
+		var donorAcquisitionDate sql.NullTime
+
+		err := rows.Scan(
+			&lot.AccountId,
+			&lot.ActivityId,
+			&lot.StockTicker,
+			&lot.Cusip,
+			&lot.Quantity,
+			&lot.AcquisitionDate,
+			&lot.TotalBasis,
+			&lot.BasisUnknown,
+			&lot.AcquisitionType,
+			&donorAcquisitionDate,
+			&lot.FairMarketValue,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		lot.DonorAcquisitionDate = donorAcquisitionDate.Time
+
+		lots[lot.ActivityId] = lot
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return lots, nil
+}
@@ -0,0 +1,96 @@
+package Data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// GetMarkToMarketFrom returns the first tax year the account's Section 475(f) mark-to-market election covers, 0 when
+// the account has no election
+func (db *DatabaseHelper) GetMarkToMarketFrom(accountNumber int) (int, error) {
+	var fromYear sql.NullInt64
+	query := "SELECT mark_to_market_from FROM account_info WHERE account_id=$1"
+	err := db.conn().QueryRow(query, accountNumber).Scan(&fromYear)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("error querying mark-to-market election: %w", err)
+	}
+	return int(fromYear.Int64), nil
+}
+
+// SetMarkToMarketFrom records the first tax year of the account's mark-to-market election, or removes the election
+// when fromYear is 0
+func (db *DatabaseHelper) SetMarkToMarketFrom(accountNumber int, fromYear int) error {
+	query := `
+        UPDATE account_info
+        SET mark_to_market_from = NULLIF($2, 0)
+        WHERE account_id = $1
+    `
+	result, err := db.conn().Exec(query, accountNumber, fromYear)
+	if err != nil {
+		return fmt.Errorf("error updating mark-to-market election: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("account %d not found", accountNumber)
+	}
+	return nil
+}
+
+// GetMarkedToMarketYears returns the tax years whose year-end deemed sales have been booked for the account
+func (db *DatabaseHelper) GetMarkedToMarketYears(accountId int) (map[int]bool, error) {
+	rows, err := db.conn().Query("SELECT tax_year FROM mark_to_market_years WHERE account_id = $1", accountId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying mark-to-market years: %w", err)
+	}
+	defer rows.Close()
+
+	years := make(map[int]bool)
+
+	for rows.Next() {
+		var taxYear int
+		if err := rows.Scan(&taxYear); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		years[taxYear] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return years, nil
+}
+
+// MarkYearMarkedToMarket records that the year-end deemed sales of a tax year were booked so they are not repeated
+func (db *DatabaseHelper) MarkYearMarkedToMarket(accountId int, taxYear int) error {
+	query := `
+		INSERT INTO mark_to_market_years (account_id, tax_year)
+		VALUES ($1, $2)
+		ON CONFLICT (account_id, tax_year) DO NOTHING
+	`
+	_, err := db.conn().Exec(query, accountId, taxYear)
+	if err != nil {
+		return fmt.Errorf("error marking tax year marked to market: %w", err)
+	}
+	return nil
+}
+
+// AddOrdinaryGain adds mark-to-market gains, which are ordinary income rather than capital gains, to a tax year's
+// balance
+func (db *DatabaseHelper) AddOrdinaryGain(accountId int, taxYear int, amount int64) error {
+	query := `
+		INSERT INTO capital_gains_balance (account_id, tax_year, net_capital_change, carryover_loss, ordinary_gain)
+		VALUES ($1, $2, 0, 0, $3)
+		ON CONFLICT (account_id, tax_year) DO UPDATE
+		SET ordinary_gain = capital_gains_balance.ordinary_gain + EXCLUDED.ordinary_gain
+	`
+	_, err := db.conn().Exec(query, accountId, taxYear, amount)
+	if err != nil {
+		return fmt.Errorf("error saving ordinary gain: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package Data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SetClosingPrice records the closing price in cents of a symbol on a trading day
+func (db *DatabaseHelper) SetClosingPrice(symbol string, date time.Time, closePrice int64) error {
+	query := `
+		INSERT INTO price_history (symbol, price_date, close_price)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (symbol, price_date) DO UPDATE SET close_price = EXCLUDED.close_price
+	`
+	_, err := db.conn().Exec(query, symbol, date.Format(time.DateOnly), closePrice)
+	if err != nil {
+		return fmt.Errorf("error saving closing price: %w", err)
+	}
+	return nil
+}
+
+// GetClosingPrice returns the last closing price recorded for a symbol on or before date along with the trading day
+// it is from, so a weekend or holiday gets the close of the trading day before it. ok is false when no price is
+// recorded within a week of date.
+func (db *DatabaseHelper) GetClosingPrice(symbol string, date time.Time) (closePrice int64, priceDate time.Time,
+	ok bool, err error) {
+	query := `
+		SELECT close_price, price_date
+		FROM price_history
+		WHERE symbol = $1 AND price_date <= $2 AND price_date > $2::DATE - 7
+		ORDER BY price_date DESC
+		LIMIT 1
+	`
+	err = db.conn().QueryRow(query, symbol, date.Format(time.DateOnly)).Scan(&closePrice, &priceDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, time.Time{}, false, nil
+	}
+	if err != nil {
+		return 0, time.Time{}, false, fmt.Errorf("error querying closing price: %w", err)
+	}
+	return closePrice, priceDate, true, nil
+}
+
+// SetNoTradingDay records that a symbol had no session on a weekday, e.g. a market holiday or a trading halt, so
+// lookups on and after it can use the close before it without asking Schwab again
+func (db *DatabaseHelper) SetNoTradingDay(symbol string, date time.Time) error {
+	query := `
+		INSERT INTO no_trading_days (symbol, trade_date)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := db.conn().Exec(query, symbol, date.Format(time.DateOnly))
+	if err != nil {
+		return fmt.Errorf("error saving no trading day: %w", err)
+	}
+	return nil
+}
+
+// GetNoTradingDays returns the days after start through end recorded as having no session for a symbol
+func (db *DatabaseHelper) GetNoTradingDays(symbol string, start time.Time, end time.Time) ([]time.Time, error) {
+	query := `
+		SELECT trade_date
+		FROM no_trading_days
+		WHERE symbol = $1 AND trade_date > $2 AND trade_date <= $3
+		ORDER BY trade_date
+	`
+
+	rows, err := db.conn().Query(query, symbol, start.Format(time.DateOnly), end.Format(time.DateOnly))
+	if err != nil {
+		return nil, fmt.Errorf("error querying no trading days: %w", err)
+	}
+	defer rows.Close()
+
+	var days []time.Time
+
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		days = append(days, day)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return days, nil
+}
@@ -0,0 +1,169 @@
+package Data
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Quantity is a share count in millionths of a share, the same way prices are carried in cents, so fractional
+// shares from Stock Slices and dividend reinvestment survive parsing, storage and matching exactly
+type Quantity int64
+
+// QuantityScale is the number of Quantity units in one share
+const QuantityScale = 1_000_000
+
+// Shares returns a whole number of shares as a Quantity
+func Shares(n int) Quantity {
+	return Quantity(n) * QuantityScale
+}
+
+// QuantityFromFloat converts a share count parsed from the Schwab API, rounding to the nearest millionth
+func QuantityFromFloat(f float64) Quantity {
+	return Quantity(math.Round(f * QuantityScale))
+}
+
+// ParseQuantity parses a decimal share count such as "12.5" exactly
+func ParseQuantity(s string) (Quantity, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	whole, fraction, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	if len(fraction) > 6 {
+		if strings.Trim(fraction[6:], "0") != "" {
+			return 0, fmt.Errorf("quantity %q has more than 6 decimal places", s)
+		}
+		fraction = fraction[:6]
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	wholeShares, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q: %w", s, err)
+	}
+	var fractionUnits int64
+	if fraction != "" {
+		fractionUnits, err = strconv.ParseInt(fraction+strings.Repeat("0", 6-len(fraction)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid quantity %q: %w", s, err)
+		}
+	}
+	if wholeShares > (math.MaxInt64-fractionUnits)/QuantityScale {
+		return 0, fmt.Errorf("quantity %q is out of range", s)
+	}
+	q := Quantity(wholeShares*QuantityScale + fractionUnits)
+	if negative {
+		q = -q
+	}
+	return q, nil
+}
+
+// isDigits reports whether s holds nothing but the digits 0 to 9
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the quantity as a decimal without trailing zeros, e.g. "12.5"
+func (q Quantity) String() string {
+	sign := ""
+	if q < 0 {
+		sign = "-"
+		q = -q
+	}
+	whole := int64(q) / QuantityScale
+	fraction := int64(q) % QuantityScale
+	if fraction == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	return strings.TrimRight(fmt.Sprintf("%s%d.%06d", sign, whole, fraction), "0")
+}
+
+// Float64 returns the quantity as a float for display only
+func (q Quantity) Float64() float64 {
+	return float64(q) / QuantityScale
+}
+
+// MulPrice returns the value in cents of the quantity at a per share price in cents, rounded to the nearest cent
+func (q Quantity) MulPrice(priceCents int64) int64 {
+	return mulDiv(priceCents, int64(q), QuantityScale, true)
+}
+
+// PerShare divides an amount in cents over the quantity, rounded to the nearest cent
+func (q Quantity) PerShare(amount int64) int64 {
+	return mulDiv(amount, QuantityScale, int64(q), true)
+}
+
+// Portion returns the share of amount that q represents out of total, truncated toward zero
+func (q Quantity) Portion(amount int64, total Quantity) int64 {
+	return mulDiv(amount, int64(q), int64(total), false)
+}
+
+// Scale multiplies the quantity by numerator / denominator, rounded to the nearest millionth, e.g. for a stock split
+func (q Quantity) Scale(numerator int, denominator int) Quantity {
+	return Quantity(mulDiv(int64(q), int64(numerator), int64(denominator), true))
+}
+
+// ScalePrice multiplies a price in cents by numerator / denominator, rounded to the nearest cent
+func ScalePrice(priceCents int64, numerator int, denominator int) int64 {
+	return mulDiv(priceCents, int64(numerator), int64(denominator), true)
+}
+
+// mulDiv computes a * b / c without overflowing the intermediate product
+func mulDiv(a int64, b int64, c int64, round bool) int64 {
+	product := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	divisor := big.NewInt(c)
+	quotient, remainder := new(big.Int).QuoRem(product, divisor, new(big.Int))
+	if round {
+		// Round half away from zero
+		twice := new(big.Int).Abs(remainder)
+		twice.Lsh(twice, 1)
+		if twice.Cmp(new(big.Int).Abs(divisor)) >= 0 {
+			if product.Sign()*divisor.Sign() < 0 {
+				quotient.Sub(quotient, big.NewInt(1))
+			} else {
+				quotient.Add(quotient, big.NewInt(1))
+			}
+		}
+	}
+	return quotient.Int64()
+}
+
+// Value stores the quantity as an exact NUMERIC
+func (q Quantity) Value() (driver.Value, error) {
+	return q.String(), nil
+}
+
+// Scan reads a NUMERIC column into the quantity
+func (q *Quantity) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*q = 0
+		return nil
+	case int64:
+		*q = Quantity(v) * QuantityScale
+		return nil
+	case float64:
+		*q = QuantityFromFloat(v)
+		return nil
+	case []byte:
+		parsed, err := ParseQuantity(string(v))
+		*q = parsed
+		return err
+	case string:
+		parsed, err := ParseQuantity(v)
+		*q = parsed
+		return err
+	}
+	return fmt.Errorf("cannot scan %T into Quantity", src)
+}
@@ -0,0 +1,192 @@
+package Data
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Quantity
+		wantErr bool
+	}{
+		{"12", Shares(12), false},
+		{"12.5", 12_500_000, false},
+		{"0.000001", 1, false},
+		{".25", 250_000, false},
+		{" 3.1 ", 3_100_000, false},
+		{"-2.75", -2_750_000, false},
+		{"1.2345670", 1_234_567, false},
+		{"1.2345678", 0, true},
+		{"abc", 0, true},
+		{"1.x", 0, true},
+		{"1.-5", 0, true},
+		{"--1", 0, true},
+		{"1.+5", 0, true},
+		{"+1", 0, true},
+		{"1 000", 0, true},
+		{"", 0, true},
+		{".", 0, true},
+		{"-", 0, true},
+		{"9223372036854.775807", math.MaxInt64, false},
+		{"9223372036854.775808", 0, true},
+		{"99999999999999", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseQuantity(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuantity(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseQuantity(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityString(t *testing.T) {
+	tests := []struct {
+		q    Quantity
+		want string
+	}{
+		{Shares(12), "12"},
+		{12_500_000, "12.5"},
+		{1, "0.000001"},
+		{-2_750_000, "-2.75"},
+		{0, "0"},
+	}
+	for _, tt := range tests {
+		if got := tt.q.String(); got != tt.want {
+			t.Errorf("Quantity(%d).String() = %q, want %q", int64(tt.q), got, tt.want)
+		}
+		if parsed, err := ParseQuantity(tt.want); err != nil || parsed != tt.q {
+			t.Errorf("ParseQuantity(%q) = %d, %v, want %d", tt.want, parsed, err, tt.q)
+		}
+	}
+}
+
+func TestQuantityFromFloat(t *testing.T) {
+	tests := []struct {
+		f    float64
+		want Quantity
+	}{
+		{0.1, 100_000},
+		{1.0000005, 1_000_001},
+		{0.3333333, 333_333},
+		{-1.5, -1_500_000},
+	}
+	for _, tt := range tests {
+		if got := QuantityFromFloat(tt.f); got != tt.want {
+			t.Errorf("QuantityFromFloat(%v) = %d, want %d", tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestMulPrice(t *testing.T) {
+	tests := []struct {
+		name  string
+		q     Quantity
+		price int64
+		want  int64
+	}{
+		{"whole shares", Shares(10), 123_45, 1_234_50},
+		{"rounds half up", 500_000, 1, 1},
+		{"rounds down below half", 499_999, 1, 0},
+		{"fractional share", 333_333, 300_00, 100_00},
+		{"negative rounds away from zero", -500_000, 1, -1},
+		{"no overflow", Shares(1_000_000_000), 1_000_000_00, 100_000_000_000_000_000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.q.MulPrice(tt.price); got != tt.want {
+				t.Errorf("Quantity(%s).MulPrice(%d) = %d, want %d", tt.q, tt.price, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPerShare(t *testing.T) {
+	tests := []struct {
+		name   string
+		q      Quantity
+		amount int64
+		want   int64
+	}{
+		{"even split", Shares(4), 100_00, 25_00},
+		{"rounds to the nearest cent", Shares(3), 100_00, 33_33},
+		{"rounds half up", Shares(2), 1, 1},
+		{"fractional share", 500_000, 10_00, 20_00},
+		{"negative amount", Shares(3), -200, -67},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.q.PerShare(tt.amount); got != tt.want {
+				t.Errorf("Quantity(%s).PerShare(%d) = %d, want %d", tt.q, tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortion(t *testing.T) {
+	tests := []struct {
+		name   string
+		q      Quantity
+		amount int64
+		total  Quantity
+		want   int64
+	}{
+		{"half", Shares(5), 100_00, Shares(10), 50_00},
+		{"truncates", Shares(1), 100_00, Shares(3), 33_33},
+		{"truncates toward zero", Shares(1), -100_00, Shares(3), -33_33},
+		{"whole", Shares(3), 100_00, Shares(3), 100_00},
+		{"none", 0, 100_00, Shares(3), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.q.Portion(tt.amount, tt.total); got != tt.want {
+				t.Errorf("Quantity(%s).Portion(%d, %s) = %d, want %d", tt.q, tt.amount, tt.total, got, tt.want)
+			}
+		})
+	}
+
+	// Portions taken from a running total add back up to the amount
+	var before Quantity
+	var sum int64
+	for _, q := range []Quantity{Shares(1), Shares(1), Shares(1)} {
+		sum += (before+q).Portion(100_00, Shares(3)) - before.Portion(100_00, Shares(3))
+		before += q
+	}
+	if sum != 100_00 {
+		t.Errorf("running portions sum to %d, want %d", sum, 100_00)
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name                   string
+		q                      Quantity
+		numerator, denominator int
+		want                   Quantity
+	}{
+		{"4-for-1 split", Shares(25), 4, 1, Shares(100)},
+		{"1-for-10 reverse split", Shares(25), 1, 10, 2_500_000},
+		{"rounds to the nearest millionth", Shares(1), 1, 3, 333_333},
+		{"rounds half up", 1, 1, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.q.Scale(tt.numerator, tt.denominator); got != tt.want {
+				t.Errorf("Quantity(%s).Scale(%d, %d) = %d, want %d", tt.q, tt.numerator, tt.denominator, got,
+					tt.want)
+			}
+		})
+	}
+	if got := ScalePrice(100_00, 1, 3); got != 33_33 {
+		t.Errorf("ScalePrice(10000, 1, 3) = %d, want 3333", got)
+	}
+	if got := ScalePrice(5, 1, 2); got != 3 {
+		t.Errorf("ScalePrice(5, 1, 2) = %d, want 3", got)
+	}
+}
@@ -0,0 +1,236 @@
+package Data
+
+import (
+	"fmt"
+	"time"
+)
+
+// RealizedGain is a row of the realized gains ledger, the result of matching part of a closing activity against a
+// single tax lot. SellActivityId is the SELL for long lots and the BUY_TO_COVER for short lots, whose proceeds come
+// from the short sale. Gain is Proceeds minus CostBasis, the recognized gain is Gain plus DisallowedLoss.
+type RealizedGain struct {
+	GainId          int64
+	AccountId       int
+	SellActivityId  int64
+	LotId           int64
+	StockTicker     string
+	SellDate        time.Time
+	Quantity        Quantity
+	Proceeds        int64
+	CostBasis       int64
+	Gain            int64
+	CostBasisMethod string
+	HoldingTerm     string
+	// BasisAdjustment is the part of CostBasis that came from adjustments to the lot rather than its purchase price
+	BasisAdjustment int64
+	// DisallowedLoss is the part of a loss deferred into replacement shares by the wash sale rule
+	DisallowedLoss int64
+	// WashSaleQuantity is how many of the sold shares have already been matched to replacement shares
+	WashSaleQuantity Quantity
+	// CorporateActionId is the corporate action that caused the sale, e.g. cash in lieu of fractional shares
+	CorporateActionId int64
+	// BasisUnknown marks a sale of shares from a lot whose cost basis was not reported
+	BasisUnknown bool
+	// DeemedSale marks the year-end sale of a position marked to market, which is bought back at the same price
+	DeemedSale bool
+}
+
+// WashSaleCandidate is a realized loss with sold shares that have not been matched to replacement shares yet
+type WashSaleCandidate struct {
+	RealizedGain
+	// HoldingPeriodStart is the holding period start of the lot that was sold, tacked onto replacement shares
+	HoldingPeriodStart time.Time
+}
+
+const realizedGainColumns = `gain_id, account_id, sell_activity_id, lot_id, stock_ticker, sell_date, quantity,
+		       proceeds, cost_basis, gain, cost_basis_method, holding_term, basis_adjustment, disallowed_loss,
+		       wash_sale_quantity, COALESCE(corporate_action_id, 0), basis_unknown,
+		       deemed_sale`
+
+func scanRealizedGain(row rowScanner) (RealizedGain, error) {
+	var gain RealizedGain
+	err := row.Scan(
+		&gain.GainId,
+		&gain.AccountId,
+		&gain.SellActivityId,
+		&gain.LotId,
+		&gain.StockTicker,
+		&gain.SellDate,
+		&gain.Quantity,
+		&gain.Proceeds,
+		&gain.CostBasis,
+		&gain.Gain,
+		&gain.CostBasisMethod,
+		&gain.HoldingTerm,
+		&gain.BasisAdjustment,
+		&gain.DisallowedLoss,
+		&gain.WashSaleQuantity,
+		&gain.CorporateActionId,
+		&gain.BasisUnknown,
+		&gain.DeemedSale,
+	)
+	return gain, err
+}
+
+// InsertRealizedGain records a sell-to-lot match in the ledger
+func (db *DatabaseHelper) InsertRealizedGain(gain RealizedGain) error {
+	query := `
+		INSERT INTO realized_gains (account_id, sell_activity_id, lot_id, stock_ticker, sell_date, quantity,
+		                            proceeds, cost_basis, gain, cost_basis_method, holding_term, basis_adjustment,
+		                            disallowed_loss, wash_sale_quantity, corporate_action_id, basis_unknown,
+		                            deemed_sale)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NULLIF($15, 0), $16, $17)
+	`
+	_, err := db.conn().Exec(query, gain.AccountId, gain.SellActivityId, gain.LotId, gain.StockTicker,
+		gain.SellDate, gain.Quantity, gain.Proceeds, gain.CostBasis, gain.Gain, gain.CostBasisMethod,
+		gain.HoldingTerm, gain.BasisAdjustment, gain.DisallowedLoss, gain.WashSaleQuantity, gain.CorporateActionId,
+		gain.BasisUnknown, gain.DeemedSale)
+	if err != nil {
+		return fmt.Errorf("error inserting realized gain: %w", err)
+	}
+	return nil
+}
+
+// GetRealizedGainsByAccountID returns every ledger row for the account in the order the sales happened
+func (db *DatabaseHelper) GetRealizedGainsByAccountID(accountId int) ([]RealizedGain, error) {
+	query := `
+		SELECT ` + realizedGainColumns + `
+		FROM realized_gains
+		WHERE account_id = $1
+		ORDER BY sell_date, gain_id
+	`
+	return db.queryRealizedGains(query, accountId)
+}
+
+// GetRealizedGainsForYear returns the ledger rows that make up the account's capital gains balance for a tax year,
+// going by the year of each sale's trade date in US Eastern time
+func (db *DatabaseHelper) GetRealizedGainsForYear(accountId int, taxYear int) ([]RealizedGain, error) {
+	query := `
+		SELECT ` + realizedGainColumns + `
+		FROM realized_gains
+		WHERE account_id = $1
+		  AND EXTRACT(YEAR FROM sell_date AT TIME ZONE 'UTC' AT TIME ZONE 'America/New_York') = $2
+		ORDER BY sell_date, gain_id
+	`
+	return db.queryRealizedGains(query, accountId, taxYear)
+}
+
+// GetRealizedGainsBySellActivityID returns how a single sell execution was matched against lots
+func (db *DatabaseHelper) GetRealizedGainsBySellActivityID(accountId int, sellActivityId int64) ([]RealizedGain,
+	error) {
+	query := `
+		SELECT ` + realizedGainColumns + `
+		FROM realized_gains
+		WHERE account_id = $1 AND sell_activity_id = $2
+		ORDER BY gain_id
+	`
+	return db.queryRealizedGains(query, accountId, sellActivityId)
+}
+
+// GetRealizedGainsByLotID returns every sale matched against a tax lot
+func (db *DatabaseHelper) GetRealizedGainsByLotID(lotId int64) ([]RealizedGain, error) {
+	query := `
+		SELECT ` + realizedGainColumns + `
+		FROM realized_gains
+		WHERE lot_id = $1
+		ORDER BY sell_date, gain_id
+	`
+	return db.queryRealizedGains(query, lotId)
+}
+
+func (db *DatabaseHelper) queryRealizedGains(query string, args ...any) ([]RealizedGain, error) {
+	rows, err := db.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying realized gains: %w", err)
+	}
+	defer rows.Close()
+
+	var gains []RealizedGain
+
+	for rows.Next() {
+		gain, err := scanRealizedGain(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		gains = append(gains, gain)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return gains, nil
+}
+
+// GetWashSaleCandidates returns realized losses on long lots for the ticker sold between from and to whose shares are
+// not yet fully matched to replacement shares, oldest sale first
+func (db *DatabaseHelper) GetWashSaleCandidates(accountId int, stockTicker string, from time.Time,
+	to time.Time) ([]WashSaleCandidate, error) {
+	query := `
+		SELECT g.gain_id, g.account_id, g.sell_activity_id, g.lot_id, g.stock_ticker, g.sell_date, g.quantity,
+		       g.proceeds, g.cost_basis, g.gain, g.cost_basis_method, g.holding_term, g.basis_adjustment,
+		       g.disallowed_loss, g.wash_sale_quantity, l.holding_period_start
+		FROM realized_gains g
+		JOIN tax_lots l ON l.lot_id = g.lot_id
+		WHERE g.account_id = $1 AND g.stock_ticker = $2 AND g.sell_date BETWEEN $3 AND $4
+		  AND g.gain < 0 AND g.wash_sale_quantity < g.quantity AND l.position_side = 'LONG'
+		ORDER BY g.sell_date, g.gain_id
+	`
+
+	rows, err := db.conn().Query(query, accountId, stockTicker, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error querying wash sale candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []WashSaleCandidate
+
+	for rows.Next() {
+		var candidate WashSaleCandidate
+
+		err := rows.Scan(
+			&candidate.GainId,
+			&candidate.AccountId,
+			&candidate.SellActivityId,
+			&candidate.LotId,
+			&candidate.StockTicker,
+			&candidate.SellDate,
+			&candidate.Quantity,
+			&candidate.Proceeds,
+			&candidate.CostBasis,
+			&candidate.Gain,
+			&candidate.CostBasisMethod,
+			&candidate.HoldingTerm,
+			&candidate.BasisAdjustment,
+			&candidate.DisallowedLoss,
+			&candidate.WashSaleQuantity,
+			&candidate.HoldingPeriodStart,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return candidates, nil
+}
+
+// AddWashSaleAdjustment records that more of a realized loss was disallowed and matched to replacement shares
+func (db *DatabaseHelper) AddWashSaleAdjustment(gainId int64, disallowedLoss int64, washSaleQuantity Quantity) error {
+	query := `
+		UPDATE realized_gains
+		SET disallowed_loss = disallowed_loss + $2, wash_sale_quantity = wash_sale_quantity + $3
+		WHERE gain_id = $1
+	`
+	_, err := db.conn().Exec(query, gainId, disallowedLoss, washSaleQuantity)
+	if err != nil {
+		return fmt.Errorf("error updating realized gain: %w", err)
+	}
+	return nil
+}
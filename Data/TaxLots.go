@@ -0,0 +1,189 @@
+package Data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TaxLot is a block of shares bought by a single BUY execution, or sold short by a single SELL_SHORT execution. For
+// short lots CostPerShare is the short sale price and AcquisitionDate the short sale date. Option lots are keyed by
+// their OCC symbol, count contracts and carry the per share premium as CostPerShare. OpenQuantity is decremented
+// as closing activities are matched against the lot, OriginalQuantity only changes when shares are split off into a
+// child lot.
+type TaxLot struct {
+	LotId            int64
+	AccountId        int
+	ActivityId       int64
+	LegId            int
+	StockTicker      string
+	OriginalQuantity Quantity
+	OpenQuantity     Quantity
+	CostPerShare     int64
+	AcquisitionDate  time.Time
+	// ParentLotId is the lot these shares were split off from, spun off of or received for in a taxable merger, 0 for
+	// lots opened directly by an activity
+	ParentLotId int64
+	// BasisAdjustment is the amount in cents added to the basis of the open shares, e.g. a disallowed wash sale loss
+	BasisAdjustment int64
+	// HoldingPeriodStart is the acquisition date unless the holding period of sold shares was tacked on
+	HoldingPeriodStart  time.Time
+	WashSaleReplacement bool
+	// PositionSide is LONG for purchased shares and SHORT for shares sold short
+	PositionSide string
+	// Multiplier is the number of shares each unit of quantity represents, 100 for option contracts
+	Multiplier int
+	// Cusip identifies the security the lot holds, empty when it is not known
+	Cusip string
+	// BasisUnknown marks a transferred-in lot whose cost basis was not reported, so CostPerShare is only a guess
+	BasisUnknown bool
+	// AcquisitionType is PURCHASE, or GIFT or INHERITANCE for shares received without buying them
+	AcquisitionType string
+	// FairMarketValue is the per share value in cents of gifted shares on the date of the gift, the basis for losses
+	// when it is below the donor's basis. 0 when it was not recorded.
+	FairMarketValue int64
+}
+
+const taxLotColumns = `lot_id, account_id, activity_id, leg_id, stock_ticker, original_quantity, open_quantity,
+		       cost_per_share, acquisition_date, COALESCE(parent_lot_id, 0), basis_adjustment, holding_period_start,
+		       wash_sale_replacement, position_side, multiplier, COALESCE(cusip, ''), basis_unknown,
+		       acquisition_type, fair_market_value`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTaxLot(row rowScanner) (TaxLot, error) {
+	var lot TaxLot
+	err := row.Scan(
+		&lot.LotId,
+		&lot.AccountId,
+		&lot.ActivityId,
+		&lot.LegId,
+		&lot.StockTicker,
+		&lot.OriginalQuantity,
+		&lot.OpenQuantity,
+		&lot.CostPerShare,
+		&lot.AcquisitionDate,
+		&lot.ParentLotId,
+		&lot.BasisAdjustment,
+		&lot.HoldingPeriodStart,
+		&lot.WashSaleReplacement,
+		&lot.PositionSide,
+		&lot.Multiplier,
+		&lot.Cusip,
+		&lot.BasisUnknown,
+		&lot.AcquisitionType,
+		&lot.FairMarketValue,
+	)
+	return lot, err
+}
+
+// InsertTaxLot records a lot and returns it with its generated id. If a lot already exists for the execution leg, the
+// stored lot is returned instead so replaying the same BUY never opens a second lot.
+func (db *DatabaseHelper) InsertTaxLot(lot TaxLot) (TaxLot, error) {
+	if lot.HoldingPeriodStart.IsZero() {
+		lot.HoldingPeriodStart = lot.AcquisitionDate
+	}
+	if lot.PositionSide == "" {
+		lot.PositionSide = "LONG"
+	}
+	if lot.Multiplier == 0 {
+		lot.Multiplier = 1
+	}
+	if lot.LegId == 0 {
+		lot.LegId = 1
+	}
+	if lot.AcquisitionType == "" {
+		lot.AcquisitionType = "PURCHASE"
+	}
+	query := `
+		INSERT INTO tax_lots (account_id, activity_id, leg_id, stock_ticker, original_quantity, open_quantity,
+		                      cost_per_share, acquisition_date, parent_lot_id, basis_adjustment,
+		                      holding_period_start, wash_sale_replacement, position_side, multiplier, cusip,
+		                      basis_unknown, acquisition_type, fair_market_value)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, 0), $10, $11, $12, $13, $14, NULLIF($15, ''), $16, $17,
+		        $18)
+		ON CONFLICT (account_id, activity_id, leg_id) WHERE parent_lot_id IS NULL DO NOTHING
+		RETURNING lot_id
+	`
+	err := db.conn().QueryRow(query, lot.AccountId, lot.ActivityId, lot.LegId, lot.StockTicker, lot.OriginalQuantity,
+		lot.OpenQuantity, lot.CostPerShare, lot.AcquisitionDate, lot.ParentLotId, lot.BasisAdjustment,
+		lot.HoldingPeriodStart, lot.WashSaleReplacement, lot.PositionSide, lot.Multiplier, lot.Cusip,
+		lot.BasisUnknown, lot.AcquisitionType, lot.FairMarketValue).Scan(&lot.LotId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.GetTaxLotByActivityID(lot.AccountId, lot.ActivityId, lot.LegId)
+	}
+	if err != nil {
+		return TaxLot{}, fmt.Errorf("error inserting tax lot: %w", err)
+	}
+	return lot, nil
+}
+
+// GetTaxLotByActivityID returns the lot opened by the given leg of a BUY or SELL_SHORT activity
+func (db *DatabaseHelper) GetTaxLotByActivityID(accountId int, activityId int64, legId int) (TaxLot, error) {
+	query := `
+		SELECT ` + taxLotColumns + `
+		FROM tax_lots
+		WHERE account_id = $1 AND activity_id = $2 AND leg_id = $3 AND parent_lot_id IS NULL
+	`
+
+	lot, err := scanTaxLot(db.conn().QueryRow(query, accountId, activityId, legId))
+	if err != nil {
+		return TaxLot{}, fmt.Errorf("error querying tax lot: %w", err)
+	}
+	return lot, nil
+}
+
+// GetOpenTaxLotsByAccountID returns every lot with shares still available to sell, oldest first
+func (db *DatabaseHelper) GetOpenTaxLotsByAccountID(accountId int) ([]TaxLot, error) {
+	query := `
+		SELECT ` + taxLotColumns + `
+		FROM tax_lots
+		WHERE account_id = $1 AND open_quantity > 0
+		ORDER BY acquisition_date, lot_id
+	`
+
+	rows, err := db.conn().Query(query, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tax lots: %w", err)
+	}
+	defer rows.Close()
+
+	var lots []TaxLot
+
+	for rows.Next() {
+		lot, err := scanTaxLot(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		lots = append(lots, lot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return lots, nil
+}
+
+// UpdateTaxLot persists the quantities, basis, holding period and security of a lot after a sell has been matched
+// against it, shares have been split off or a corporate action adjusted it
+func (db *DatabaseHelper) UpdateTaxLot(lot TaxLot) error {
+	query := `
+		UPDATE tax_lots
+		SET original_quantity = $2, open_quantity = $3, basis_adjustment = $4, holding_period_start = $5,
+		    wash_sale_replacement = $6, cost_per_share = $7, stock_ticker = $8, cusip = NULLIF($9, ''),
+		    fair_market_value = $10
+		WHERE lot_id = $1
+	`
+	_, err := db.conn().Exec(query, lot.LotId, lot.OriginalQuantity, lot.OpenQuantity, lot.BasisAdjustment,
+		lot.HoldingPeriodStart, lot.WashSaleReplacement, lot.CostPerShare, lot.StockTicker, lot.Cusip,
+		lot.FairMarketValue)
+	if err != nil {
+		return fmt.Errorf("error updating tax lot: %w", err)
+	}
+	return nil
+}
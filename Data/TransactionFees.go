@@ -0,0 +1,73 @@
+package Data
+
+import (
+	"fmt"
+)
+
+// TransactionFee is a single commission or regulatory fee charged on an execution
+type TransactionFee struct {
+	AccountId  int
+	ActivityId int64
+	// LegId is the execution leg the fee was charged on, fees recorded without one go on leg 1
+	LegId int
+	// FeeType is one of COMMISSION, SEC_FEE, TAF_FEE, OPT_REG_FEE, INDEX_OPTION_FEE or OTHER
+	FeeType string
+	// Amount is the fee in cents
+	Amount int64
+}
+
+// UpsertTransactionFee records a fee for an execution, replacing any amount already recorded for the same fee type.
+// Fees recorded after the execution was matched only take effect once the account is recomputed.
+func (db *DatabaseHelper) UpsertTransactionFee(fee TransactionFee) error {
+	query := `
+		INSERT INTO transaction_fees (account_id, activity_id, leg_id, fee_type, amount)
+		VALUES ($1, $2, COALESCE(NULLIF($3, 0), 1), $4, $5)
+		ON CONFLICT (account_id, activity_id, leg_id, fee_type) DO UPDATE SET amount = EXCLUDED.amount
+	`
+	_, err := db.conn().Exec(query, fee.AccountId, fee.ActivityId, fee.LegId, fee.FeeType, fee.Amount)
+	if err != nil {
+		return fmt.Errorf("error saving transaction fee: %w", err)
+	}
+	return nil
+}
+
+// GetTransactionFees returns every fee recorded for an activity across all of its legs
+func (db *DatabaseHelper) GetTransactionFees(accountId int, activityId int64) ([]TransactionFee, error) {
+	query := `
+		SELECT account_id, activity_id, leg_id, fee_type, amount
+		FROM transaction_fees
+		WHERE account_id = $1 AND activity_id = $2
+		ORDER BY leg_id, fee_type
+	`
+
+	rows, err := db.conn().Query(query, accountId, activityId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying transaction fees: %w", err)
+	}
+	defer rows.Close()
+
+	var fees []TransactionFee
+
+	for rows.Next() {
+		var fee TransactionFee
+
+		err := rows.Scan(
+			&fee.AccountId,
+			&fee.ActivityId,
+			&fee.LegId,
+			&fee.FeeType,
+			&fee.Amount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		fees = append(fees, fee)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return fees, nil
+}
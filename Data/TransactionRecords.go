@@ -0,0 +1,126 @@
+package Data
+
+import (
+	"fmt"
+	"gains/Data/JsonParser"
+	"math"
+	"strings"
+)
+
+// InsertTradeRecords records every security moved by TRADE transactions from the transactions endpoint as its own
+// transaction_history row, numbering the securities of a transaction as its legs, along with the fees charged on the
+// trade. Transactions already recorded are skipped, so overlapping polls can be replayed. The number of rows inserted
+// is returned.
+func (db *DatabaseHelper) InsertTradeRecords(accountId int, transactions []JsonParser.Transaction) (int64, error) {
+	query := `
+		INSERT INTO transaction_history (account_id, order_id, activity_id, leg_id, stock_ticker, share_count,
+		                                 stock_price, order_type, activity_date, matched, cusip, asset_type,
+		                                 instrument_id, position_effect)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, false, NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, 0),
+		        NULLIF($13, ''))
+		ON CONFLICT DO NOTHING
+	`
+	var rowsAffected int64
+	for _, transaction := range transactions {
+		if transaction.Type != JsonParser.TradeTransaction {
+			continue
+		}
+		tradeTime, err := transaction.TradeTime()
+		if err != nil {
+			return rowsAffected, fmt.Errorf("invalid time on trade %d: %w", transaction.ActivityId, err)
+		}
+		for i, item := range transaction.Securities() {
+			result, err := db.conn().Exec(query, accountId, transaction.OrderId, transaction.ActivityId, i+1,
+				item.Instrument.Symbol, QuantityFromFloat(math.Abs(item.Amount)), int64(math.Round(item.Price*100)),
+				tradeOrderType(transaction, item), tradeTime.UTC(), item.Instrument.Cusip,
+				item.Instrument.AssetType, item.Instrument.InstrumentId, item.PositionEffect)
+			if err != nil {
+				return rowsAffected, fmt.Errorf("error inserting trade %d: %w", transaction.ActivityId, err)
+			}
+			inserted, err := result.RowsAffected()
+			if err != nil {
+				return rowsAffected, err
+			}
+			rowsAffected += inserted
+		}
+
+		fees := make(map[string]int64)
+		for _, item := range transaction.Fees() {
+			fees[feeType(item.FeeType)] += int64(math.Round(math.Abs(item.Cost) * 100))
+		}
+		for name, amount := range fees {
+			err := db.UpsertTransactionFee(TransactionFee{
+				AccountId:  accountId,
+				ActivityId: transaction.ActivityId,
+				FeeType:    name,
+				Amount:     amount,
+			})
+			if err != nil {
+				return rowsAffected, err
+			}
+		}
+	}
+	return rowsAffected, nil
+}
+
+// tradeOrderType works out the instruction a traded security was filled with from the direction it moved and whether
+// it opened or closed a position. Shares bought without an order by reinvesting a dividend are REINVEST.
+func tradeOrderType(transaction JsonParser.Transaction, item JsonParser.TransferItem) string {
+	bought := item.Amount > 0
+	if item.Instrument.AssetType == "OPTION" {
+		switch {
+		case bought && item.PositionEffect == "CLOSING":
+			return "BUY_TO_CLOSE"
+		case bought:
+			return "BUY_TO_OPEN"
+		case item.PositionEffect == "OPENING":
+			return "SELL_TO_OPEN"
+		default:
+			return "SELL_TO_CLOSE"
+		}
+	}
+	switch {
+	case bought && item.PositionEffect == "CLOSING":
+		return "BUY_TO_COVER"
+	case bought && transaction.OrderId == 0 && strings.Contains(strings.ToUpper(transaction.Description), "REINVEST"):
+		return "REINVEST"
+	case bought:
+		return "BUY"
+	case item.PositionEffect == "OPENING":
+		return "SELL_SHORT"
+	default:
+		return "SELL"
+	}
+}
+
+// feeType maps a Schwab fee type onto the fee types transaction_fees keeps apart, OTHER for the rest
+func feeType(schwabFeeType string) string {
+	switch schwabFeeType {
+	case "COMMISSION", "SEC_FEE", "TAF_FEE", "OPT_REG_FEE", "INDEX_OPTION_FEE":
+		return schwabFeeType
+	}
+	return "OTHER"
+}
+
+// HasMatchedTransaction reports whether any leg of an activity of the account has already been matched
+func (db *DatabaseHelper) HasMatchedTransaction(accountId int, activityId int64) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM transaction_history
+	                         WHERE account_id = $1 AND activity_id = $2 AND matched = true)`
+	err := db.conn().QueryRow(query, accountId, activityId).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error querying transactions: %w", err)
+	}
+	return exists, nil
+}
+
+// HasTransaction reports whether an activity of the account is already recorded in transaction_history
+func (db *DatabaseHelper) HasTransaction(accountId int, activityId int64) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM transaction_history WHERE account_id = $1 AND activity_id = $2)`
+	err := db.conn().QueryRow(query, accountId, activityId).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error querying transactions: %w", err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,74 @@
+package Data
+
+import (
+	"gains/Data/JsonParser"
+	"testing"
+)
+
+func TestTradeOrderType(t *testing.T) {
+	stock := JsonParser.TransactionInstrument{AssetType: "EQUITY", Symbol: "VTI"}
+	option := JsonParser.TransactionInstrument{AssetType: "OPTION", Symbol: "AAPL  240119C00190000"}
+	trade := JsonParser.Transaction{Type: JsonParser.TradeTransaction, OrderId: 1001, Description: "Buy Trade"}
+	reinvestment := JsonParser.Transaction{Type: JsonParser.TradeTransaction, Description: "DIVIDEND REINVESTMENT"}
+
+	tests := []struct {
+		name        string
+		transaction JsonParser.Transaction
+		item        JsonParser.TransferItem
+		want        string
+	}{
+		{"stock bought", trade, JsonParser.TransferItem{Instrument: stock, Amount: 10, PositionEffect: "OPENING"},
+			"BUY"},
+		{"stock bought without a position effect", trade, JsonParser.TransferItem{Instrument: stock, Amount: 10},
+			"BUY"},
+		{"stock sold", trade, JsonParser.TransferItem{Instrument: stock, Amount: -10, PositionEffect: "CLOSING"},
+			"SELL"},
+		{"stock sold without a position effect", trade, JsonParser.TransferItem{Instrument: stock, Amount: -10},
+			"SELL"},
+		{"stock sold short", trade, JsonParser.TransferItem{Instrument: stock, Amount: -10,
+			PositionEffect: "OPENING"}, "SELL_SHORT"},
+		{"short covered", trade, JsonParser.TransferItem{Instrument: stock, Amount: 10, PositionEffect: "CLOSING"},
+			"BUY_TO_COVER"},
+		{"dividend reinvested", reinvestment, JsonParser.TransferItem{Instrument: stock, Amount: 0.25}, "REINVEST"},
+		{"reinvestment wording on an order is a buy", JsonParser.Transaction{OrderId: 1002,
+			Description: "Reinvest"}, JsonParser.TransferItem{Instrument: stock, Amount: 1}, "BUY"},
+		{"option bought to open", trade, JsonParser.TransferItem{Instrument: option, Amount: 1,
+			PositionEffect: "OPENING"}, "BUY_TO_OPEN"},
+		{"option bought to close", trade, JsonParser.TransferItem{Instrument: option, Amount: 1,
+			PositionEffect: "CLOSING"}, "BUY_TO_CLOSE"},
+		{"option sold to open", trade, JsonParser.TransferItem{Instrument: option, Amount: -1,
+			PositionEffect: "OPENING"}, "SELL_TO_OPEN"},
+		{"option sold to close", trade, JsonParser.TransferItem{Instrument: option, Amount: -1,
+			PositionEffect: "CLOSING"}, "SELL_TO_CLOSE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tradeOrderType(tt.transaction, tt.item); got != tt.want {
+				t.Errorf("tradeOrderType() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeeType(t *testing.T) {
+	tests := []struct {
+		schwabFeeType string
+		want          string
+	}{
+		{"COMMISSION", "COMMISSION"},
+		{"SEC_FEE", "SEC_FEE"},
+		{"TAF_FEE", "TAF_FEE"},
+		{"OPT_REG_FEE", "OPT_REG_FEE"},
+		{"INDEX_OPTION_FEE", "INDEX_OPTION_FEE"},
+		{"CDSC_FEE", "OTHER"},
+		{"commission", "OTHER"},
+		{"", "OTHER"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schwabFeeType, func(t *testing.T) {
+			if got := feeType(tt.schwabFeeType); got != tt.want {
+				t.Errorf("feeType(%q) = %s, want %s", tt.schwabFeeType, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package Endpoints
+
+import (
+	"gains/Data/JsonParser"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quoteBatchSize is the most symbols requested from the quotes endpoint at once
+const quoteBatchSize = 100
+
+// quoteCacheTTL is how long a quote is reused before it is requested again
+const quoteCacheTTL = 15 * time.Second
+
+// quoteCache keeps recently fetched quotes so repeated valuations within a few seconds don't hit the API
+type quoteCache struct {
+	mu     sync.Mutex
+	quotes map[string]cachedQuote
+}
+
+type cachedQuote struct {
+	quote   JsonParser.Quote
+	fetched time.Time
+}
+
+func newQuoteCache() *quoteCache {
+	return &quoteCache{quotes: make(map[string]cachedQuote)}
+}
+
+// get returns the cached quote of a symbol if it is still fresh
+func (c *quoteCache) get(symbol string, now time.Time) (JsonParser.Quote, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.quotes[symbol]
+	if !ok || now.Sub(cached.fetched) > quoteCacheTTL {
+		return JsonParser.Quote{}, false
+	}
+	return cached.quote, true
+}
+
+func (c *quoteCache) put(quotes map[string]JsonParser.Quote, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for symbol, quote := range quotes {
+		c.quotes[symbol] = cachedQuote{quote: quote, fetched: now}
+	}
+}
+
+// GetQuotes returns the quotes of the symbols keyed by symbol, requesting the ones not quoted in the last few seconds
+// in batches. Symbols Schwab could not quote are left out of the result.
+func (api *SchwabAPI) GetQuotes(symbols ...string) (map[string]JsonParser.Quote, error) {
+	if api.quotes == nil {
+		api.quotes = newQuoteCache()
+	}
+	now := time.Now()
+	quotes := make(map[string]JsonParser.Quote, len(symbols))
+	var missing []string
+	seen := make(map[string]bool)
+	for _, symbol := range symbols {
+		if seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		if quote, ok := api.quotes.get(symbol, now); ok {
+			quotes[symbol] = quote
+		} else {
+			missing = append(missing, symbol)
+		}
+	}
+
+	for start := 0; start < len(missing); start += quoteBatchSize {
+		batch := missing[start:min(start+quoteBatchSize, len(missing))]
+		fetched, err := api.GetQuotesApi(batch)
+		if err != nil {
+			return nil, err
+		}
+		api.quotes.put(fetched, now)
+		for symbol, quote := range fetched {
+			quotes[symbol] = quote
+		}
+	}
+	return quotes, nil
+}
+
+// GetQuotesApi send the API request to quote the symbols, bypassing the cache
+func (api *SchwabAPI) GetQuotesApi(symbols []string) (map[string]JsonParser.Quote, error) {
+	query := url.Values{}
+	query.Add("symbols", strings.Join(symbols, ","))
+	query.Add("fields", "quote")
+	response, err := api.doRequest("GET", api.MarketDataURL, "/quotes?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return JsonParser.ParseQuotes(response)
+}
@@ -0,0 +1,165 @@
+package Endpoints
+
+import (
+	"errors"
+	"fmt"
+	"gains/Data"
+	"gains/Data/JsonParser"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ErrNoClosingPrice is returned by PriceOnDate when the symbol did not trade in the week up to the date
+var ErrNoClosingPrice = errors.New("no closing price")
+
+// priceLookback is how far before the requested date a closing price is looked for, enough to cover a weekend
+// followed by a holiday
+const priceLookback = 7 * 24 * time.Hour
+
+// GetDailyPriceHistory requests the daily candles of a symbol for the trading days from start through end
+func (api *SchwabAPI) GetDailyPriceHistory(symbol string, start time.Time, end time.Time) (JsonParser.PriceHistory,
+	error) {
+	params := map[string]string{
+		"symbol":                symbol,
+		"periodType":            "month",
+		"frequencyType":         "daily",
+		"frequency":             "1",
+		"startDate":             strconv.FormatInt(start.UnixMilli(), 10),
+		"endDate":               strconv.FormatInt(end.UnixMilli(), 10),
+		"needExtendedHoursData": "false",
+	}
+	response, err := api.GetPriceHistoryApi(params)
+	if err != nil {
+		return JsonParser.PriceHistory{}, err
+	}
+	return JsonParser.ParsePriceHistory(response)
+}
+
+// GetPriceHistoryApi send the API request to retrieve the candles of a symbol matching the given parameters, e.g.
+// symbol, periodType, frequencyType, startDate and endDate
+func (api *SchwabAPI) GetPriceHistoryApi(params map[string]string) ([]byte, error) {
+	query := url.Values{}
+	for key, value := range params {
+		query.Add(key, value)
+	}
+	return api.doRequest("GET", api.MarketDataURL, "/pricehistory?"+query.Encode(), nil)
+}
+
+// PriceHistory looks up closing prices, keeping every close fetched from Schwab in the price_history table and every
+// weekday found without one in no_trading_days, so each trading day and holiday is only requested once
+type PriceHistory struct {
+	api *SchwabAPI
+	db  *Data.DatabaseHelper
+}
+
+func NewPriceHistory(api *SchwabAPI, db *Data.DatabaseHelper) *PriceHistory {
+	return &PriceHistory{api: api, db: db}
+}
+
+// PriceOnDate returns the closing price in cents of a symbol on the calendar date of date, along with the trading day
+// the price is from. On a weekend or market holiday that is the close of the last trading day before it, the way
+// Schwab values positions over a closed market. ErrNoClosingPrice is returned when the symbol has no close in the
+// week up to the date, e.g. a date before it listed or one whose session has not closed yet.
+func (h *PriceHistory) PriceOnDate(symbol string, date time.Time) (int64, time.Time, error) {
+	year, month, day := date.Date()
+	date = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	start := date.Add(-priceLookback)
+
+	closePrice, priceDate, ok, err := h.db.GetClosingPrice(symbol, date)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if !ok {
+		priceDate = start
+	}
+	known, err := h.noSessionsBetween(symbol, priceDate, date)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if !known {
+		if err := h.fetch(symbol, start, date); err != nil {
+			return 0, time.Time{}, err
+		}
+		closePrice, priceDate, ok, err = h.db.GetClosingPrice(symbol, date)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+	}
+
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("%w for %s on %s", ErrNoClosingPrice, symbol, date.Format(time.DateOnly))
+	}
+	return closePrice, priceDate, nil
+}
+
+// fetch requests the daily candles of a symbol after start through date and records the close of every session that
+// is over. Weekdays without a candle are recorded as having no session once a later session or the next day has
+// closed, so a close Schwab has not published yet is not mistaken for a holiday.
+func (h *PriceHistory) fetch(symbol string, start time.Time, date time.Time) error {
+	history, err := h.api.GetDailyPriceHistory(symbol, start, date.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	traded := make(map[string]bool)
+	var lastTraded time.Time
+	for _, candle := range history.Candles {
+		tradeDate := candle.TradeDate()
+		if !sessionClosed(tradeDate) {
+			continue
+		}
+		if err := h.db.SetClosingPrice(symbol, tradeDate, int64(math.Round(candle.Close*100))); err != nil {
+			return err
+		}
+		traded[tradeDate.Format(time.DateOnly)] = true
+		if tradeDate.After(lastTraded) {
+			lastTraded = tradeDate
+		}
+	}
+
+	for d := start.AddDate(0, 0, 1); !d.After(date); d = d.AddDate(0, 0, 1) {
+		if weekend(d) || traded[d.Format(time.DateOnly)] {
+			continue
+		}
+		if d.Before(lastTraded) || sessionClosed(d.AddDate(0, 0, 1)) {
+			if err := h.db.SetNoTradingDay(symbol, d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// noSessionsBetween reports whether every day after priceDate through date is a weekend or recorded as having no
+// session, so the close recorded for priceDate is known to be the latest one on or before date
+func (h *PriceHistory) noSessionsBetween(symbol string, priceDate time.Time, date time.Time) (bool, error) {
+	noTradingDays, err := h.db.GetNoTradingDays(symbol, priceDate, date)
+	if err != nil {
+		return false, err
+	}
+	closed := make(map[string]bool)
+	for _, day := range noTradingDays {
+		closed[day.Format(time.DateOnly)] = true
+	}
+
+	year, month, day := priceDate.Date()
+	for d := time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC); !d.After(date); d = d.AddDate(0, 0, 1) {
+		if !weekend(d) && !closed[d.Format(time.DateOnly)] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// sessionClosed reports whether the regular session of a trading day is over, so its candle holds the closing price
+// rather than the last trade so far
+func sessionClosed(tradeDate time.Time) bool {
+	year, month, day := tradeDate.Date()
+	return time.Now().After(time.Date(year, month, day, 16, 0, 0, 0, Data.EasternTime))
+}
+
+// weekend reports whether a date falls on a Saturday or Sunday, when the US exchanges never trade
+func weekend(date time.Time) bool {
+	return date.Weekday() == time.Saturday || date.Weekday() == time.Sunday
+}
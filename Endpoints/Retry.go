@@ -0,0 +1,180 @@
+package Endpoints
+
+import (
+	"errors"
+	"gains/Properties"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting Schwab while repeated server or network failures have the circuit
+// breaker open
+var ErrCircuitOpen = errors.New("schwab API unavailable, circuit breaker is open")
+
+// RetryPolicy is how a request failing with a server or network error, or rate limited, is retried. The wait before
+// each retry doubles from BaseDelay up to MaxDelay, with up to half of it randomized so clients don't retry in step.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy given to new SchwabAPI clients
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+
+// ConfigureRetries sets the retry policy of new SchwabAPI clients from the config, keeping the defaults for anything
+// it leaves unset
+func ConfigureRetries(config *Properties.Config) {
+	if config.MaxRetries != nil {
+		DefaultRetryPolicy.MaxRetries = max(*config.MaxRetries, 0)
+	}
+	if config.RetryBaseDelayMs > 0 {
+		DefaultRetryPolicy.BaseDelay = time.Duration(config.RetryBaseDelayMs) * time.Millisecond
+	}
+	if config.RetryMaxDelayMs > 0 {
+		DefaultRetryPolicy.MaxDelay = time.Duration(config.RetryMaxDelayMs) * time.Millisecond
+	}
+}
+
+// backoff returns the wait before retry number attempt, counting from 0
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if attempt < 32 && p.BaseDelay<<attempt < p.MaxDelay {
+		delay = p.BaseDelay << attempt
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryable reports whether a request that failed with err may succeed if sent again
+func retryable(err error) bool {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// outage reports whether err means Schwab is down or unreachable rather than refusing this particular request
+func outage(err error) bool {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// retryAfter returns the wait a 429 response asks for in its Retry-After header, given either in seconds or as a
+// date, or 0 when it has none
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// rateLimiter is a token bucket holding up to capacity requests, refilled evenly over each period
+type rateLimiter struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	perSec   float64
+	last     time.Time
+}
+
+func newRateLimiter(requests int, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		capacity: float64(requests),
+		tokens:   float64(requests),
+		perSec:   float64(requests) / period.Seconds(),
+		last:     time.Now(),
+	}
+}
+
+// wait blocks until a request may be sent and takes its token
+func (l *rateLimiter) wait() {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.capacity, l.tokens+now.Sub(l.last).Seconds()*l.perSec)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return
+		}
+		delay := time.Duration((1 - l.tokens) / l.perSec * float64(time.Second))
+		l.mu.Unlock()
+		time.Sleep(delay)
+	}
+}
+
+// circuitBreaker stops requests for a cooldown after threshold requests in a row failed with an outage. Once the
+// cooldown is over a single request is let through to probe Schwab, closing the breaker if it succeeds and opening it
+// for another cooldown if it doesn't.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether a request may be sent
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	now := time.Now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+// success records a request Schwab answered, closing the breaker
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.threshold {
+		slog.Info("Schwab API is reachable again, resuming requests")
+	}
+	b.failures = 0
+}
+
+// failure records a request that failed with an outage, opening the breaker once threshold are reached
+func (b *circuitBreaker) failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+	if b.failures == b.threshold {
+		slog.Error("Schwab API keeps failing, pausing requests", "cooldown", b.cooldown, "error", err)
+	}
+}
+
+// Schwab's quota is per app rather than per client, so every SchwabAPI in the process shares the limiter and breaker
+var (
+	schwabLimiter = newRateLimiter(120, time.Minute)
+	schwabBreaker = &circuitBreaker{threshold: 5, cooldown: time.Minute}
+)
@@ -0,0 +1,142 @@
+package Endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, BaseDelay: 500 * time.Millisecond, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 500 * time.Millisecond},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+		{40, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempt), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := policy.backoff(tt.attempt); got < tt.want/2 || got > tt.want {
+					t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+
+	if got := (RetryPolicy{}).backoff(0); got != 0 {
+		t.Errorf("backoff without delays = %s, want 0", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"absent", "", 0, 0},
+		{"seconds", "30", 30 * time.Second, 30 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-5", 0, 0},
+		{"date in the future", time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat), 80 * time.Second,
+			90 * time.Second},
+		{"date in the past", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+		{"garbage", "soon", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.header); got < tt.min || got > tt.max {
+				t.Errorf("retryAfter(%q) = %s, want between %s and %s", tt.header, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRetryableAndOutage(t *testing.T) {
+	networkErr := &url.Error{Op: "Get", URL: "https://api.schwabapi.com", Err: errors.New("connection refused")}
+	tests := []struct {
+		name          string
+		err           error
+		wantRetryable bool
+		wantOutage    bool
+	}{
+		{"rate limited", &ApiError{Code: http.StatusTooManyRequests}, true, false},
+		{"server error", &ApiError{Code: http.StatusInternalServerError}, true, true},
+		{"gateway timeout", &ApiError{Code: http.StatusGatewayTimeout}, true, true},
+		{"unauthorized", &ApiError{Code: http.StatusUnauthorized}, false, false},
+		{"bad request", &ApiError{Code: http.StatusBadRequest}, false, false},
+		{"network error", networkErr, true, true},
+		{"wrapped server error", fmt.Errorf("error getting quotes: %w", &ApiError{Code: 502}), true, true},
+		{"other error", errors.New("invalid JSON"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.wantRetryable {
+				t.Errorf("retryable() = %v, want %v", got, tt.wantRetryable)
+			}
+			if got := outage(tt.err); got != tt.wantOutage {
+				t.Errorf("outage() = %v, want %v", got, tt.wantOutage)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	breaker := &circuitBreaker{threshold: 3, cooldown: cooldown}
+	outageErr := &ApiError{Code: http.StatusServiceUnavailable}
+
+	// Closed: failures below the threshold and a success in between keep requests flowing
+	breaker.failure(outageErr)
+	breaker.failure(outageErr)
+	breaker.success()
+	breaker.failure(outageErr)
+	breaker.failure(outageErr)
+	if !breaker.allow() {
+		t.Fatal("breaker opened before threshold failures in a row")
+	}
+
+	// Open: the threshold is reached and requests are refused for the cooldown
+	breaker.failure(outageErr)
+	if breaker.allow() {
+		t.Fatal("breaker allowed a request right after opening")
+	}
+
+	// Half open: after the cooldown a single probe is let through
+	time.Sleep(cooldown + 10*time.Millisecond)
+	if !breaker.allow() {
+		t.Fatal("breaker refused the probe after the cooldown")
+	}
+	if breaker.allow() {
+		t.Fatal("breaker let a second request through while probing")
+	}
+
+	// A failed probe opens it for another cooldown
+	breaker.failure(outageErr)
+	if breaker.allow() {
+		t.Fatal("breaker allowed a request after the probe failed")
+	}
+	time.Sleep(cooldown + 10*time.Millisecond)
+	if !breaker.allow() {
+		t.Fatal("breaker refused the second probe after the cooldown")
+	}
+
+	// A successful probe closes it
+	breaker.success()
+	for i := 0; i < 3; i++ {
+		if !breaker.allow() {
+			t.Fatalf("request %d refused after the breaker closed", i+1)
+		}
+	}
+}
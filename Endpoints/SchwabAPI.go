@@ -7,8 +7,10 @@ import (
 	_ "gains/Data"
 	"gains/Data/JsonParser"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -16,39 +18,86 @@ type SchwabAPI struct {
 	BaseURL     string
 	BearerToken string
 	HttpClient  *http.Client
+	// MarketDataURL is the base of the market data endpoints, which live outside the trader API
+	MarketDataURL string
+	// Retry is how failed requests are retried
+	Retry  RetryPolicy
+	quotes *quoteCache
 }
 
 func NewSchwabAPI(bearerToken string) *SchwabAPI {
 	return &SchwabAPI{
-		BaseURL:     "https://api.schwabapi.com/trader/v1",
-		BearerToken: bearerToken,
-		HttpClient:  &http.Client{Timeout: 10 * time.Second},
+		BaseURL:       "https://api.schwabapi.com/trader/v1",
+		BearerToken:   bearerToken,
+		HttpClient:    &http.Client{Timeout: 10 * time.Second},
+		MarketDataURL: "https://api.schwabapi.com/marketdata/v1",
+		Retry:         DefaultRetryPolicy,
+		quotes:        newQuoteCache(),
 	}
 }
 
 // DoRequest is a generic method to interact with Schwab endpoints
 func (api *SchwabAPI) DoRequest(method, endpoint string, body interface{}) ([]byte, error) {
-	url := fmt.Sprintf("%s%s", api.BaseURL, endpoint)
+	return api.doRequest(method, api.BaseURL, endpoint, body)
+}
+
+// doRequest sends a request to an endpoint under baseURL within the rate limit. Server and network errors are retried
+// with backoff and rate limited requests after the wait Schwab asks for, until the retry policy gives up.
+func (api *SchwabAPI) doRequest(method, baseURL, endpoint string, body interface{}) ([]byte, error) {
+	url := fmt.Sprintf("%s%s", baseURL, endpoint)
 	jsonBody, _ := json.Marshal(body)
 
+	if !schwabBreaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+	for attempt := 0; ; attempt++ {
+		schwabLimiter.wait()
+		response, wait, err := api.send(method, url, jsonBody)
+		if err == nil {
+			schwabBreaker.success()
+			return response, nil
+		}
+		if !retryable(err) || attempt >= api.Retry.MaxRetries {
+			if outage(err) {
+				schwabBreaker.failure(err)
+			} else {
+				schwabBreaker.success()
+			}
+			return nil, err
+		}
+		if wait == 0 {
+			wait = api.Retry.backoff(attempt)
+		}
+		slog.Debug("Retrying Schwab request", "endpoint", endpoint, "attempt", attempt+1, "wait", wait, "error", err)
+		time.Sleep(wait)
+	}
+}
+
+// send makes a single attempt at a request, returning the wait asked for by the Retry-After header of a rate limited
+// response along with its error
+func (api *SchwabAPI) send(method, url string, jsonBody []byte) ([]byte, time.Duration, error) {
 	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+api.BearerToken)
 
 	resp, err := api.HttpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		err = ReportError(resp.StatusCode, resp.Status)
-		return nil, err
+		var wait time.Duration
+		if resp.StatusCode == http.StatusTooManyRequests {
+			wait = retryAfter(resp.Header.Get("Retry-After"))
+		}
+		return nil, wait, ReportError(resp.StatusCode, resp.Status)
 	}
-	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	response, err := io.ReadAll(resp.Body)
+	return response, 0, err
 }
 
 // GetAllOrders requests the Schwab API to retrieve any orders in the last 6 months
@@ -90,6 +139,49 @@ func (api *SchwabAPI) GetAllOrdersApi(hashedAccountId string, params map[string]
 	return api.DoRequest("GET", endpoint, nil)
 }
 
+// GetTransactions requests the account's transactions between from and to, at most a year apart, limited to the given
+// types such as TRADE or DIVIDEND_OR_INTEREST, or of every type when none are given
+func (api *SchwabAPI) GetTransactions(hashedAccountId string, from time.Time, to time.Time,
+	types ...string) ([]JsonParser.Transaction, error) {
+	params := map[string]string{
+		"startDate": from.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"endDate":   to.UTC().Format("2006-01-02T15:04:05.000Z"),
+	}
+	if len(types) > 0 {
+		params["types"] = strings.Join(types, ",")
+	}
+	response, err := api.GetTransactionsApi(hashedAccountId, params)
+	if err != nil {
+		return nil, err
+	}
+	return JsonParser.ParseTransactions(response)
+}
+
+// GetTransactionsApi send the API request to retrieve the account's transactions matching the given filters, e.g.
+// startDate, endDate, types and symbol
+func (api *SchwabAPI) GetTransactionsApi(hashedAccountId string, params map[string]string) ([]byte, error) {
+	endpoint := "/accounts/" + hashedAccountId + "/transactions"
+	query := url.Values{}
+	for key, value := range params {
+		query.Add(key, value)
+	}
+
+	if query.Encode() != "" {
+		endpoint += "?" + query.Encode()
+	}
+	return api.DoRequest("GET", endpoint, nil)
+}
+
+// GetPositions requests the positions Schwab holds in the account
+func (api *SchwabAPI) GetPositions(hashedAccountId string) ([]JsonParser.Position, error) {
+	endpoint := "/accounts/" + hashedAccountId + "?fields=positions"
+	response, err := api.DoRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	return JsonParser.ParsePositions(response)
+}
+
 // GetAccountNumbers send the API request to retrieve account numbers associated with the active bearer token
 func (api *SchwabAPI) GetAccountNumbers() (JsonParser.Account, error) {
 	endpoint := "/accounts/accountNumbers"
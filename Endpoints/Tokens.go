@@ -0,0 +1,41 @@
+package Endpoints
+
+import (
+	"gains/Properties"
+	"gains/TokenManager"
+	"log/slog"
+)
+
+// InitializeTokens checks if Schwab auth tokens in config are still valid. If not, retrieve new ones. The tokens in
+// use are saved back to the config and a SchwabAPI authorized with them is returned.
+func InitializeTokens(config *Properties.Config, tm *TokenManager.TokenManager) (*SchwabAPI, error) {
+	var schwabAPI *SchwabAPI
+
+	// Set tokens if available
+	if config.BearerToken != "" && config.RefreshToken != "" {
+		tm.SetAuthTokens(config.BearerToken, config.RefreshToken)
+		schwabAPI = NewSchwabAPI(tm.BearerToken)
+
+		if _, err := schwabAPI.GetAccountNumbers(); err != nil {
+			slog.Warn("Cached tokens are invalid, need to grab new ones.")
+			err = tm.RefreshTokens()
+			if err != nil {
+				tm.GetAuthTokens()
+			}
+			err := config.UpdateTokens(tm.BearerToken, tm.RefreshToken)
+			if err != nil {
+				return nil, err
+			}
+			schwabAPI = NewSchwabAPI(tm.BearerToken)
+		}
+	} else {
+		tm.GetAuthTokens()
+		schwabAPI = NewSchwabAPI(tm.BearerToken)
+		err := config.UpdateTokens(tm.BearerToken, tm.RefreshToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return schwabAPI, nil
+}
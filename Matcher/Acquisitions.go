@@ -0,0 +1,59 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"time"
+)
+
+// How shares in a lot were acquired
+const (
+	PurchaseAcquisition    = "PURCHASE"
+	GiftAcquisition        = "GIFT"
+	InheritanceAcquisition = "INHERITANCE"
+)
+
+// ValidAcquisitionType reports whether acquisitionType is one of the acquisition types
+func ValidAcquisitionType(acquisitionType string) bool {
+	switch acquisitionType {
+	case PurchaseAcquisition, GiftAcquisition, InheritanceAcquisition:
+		return true
+	}
+	return false
+}
+
+// purchased reports whether a lot's shares were bought rather than received as a gift or inheritance. Only purchased
+// shares can be replacement shares in a wash sale.
+func purchased(lot *Data.TaxLot) bool {
+	return lot.AcquisitionType != GiftAcquisition && lot.AcquisitionType != InheritanceAcquisition
+}
+
+// lotHoldingTerm classifies a sale of shares from a lot on the sold trade date. Inherited shares are long term no
+// matter how long they were held.
+func lotHoldingTerm(lot *Data.TaxLot, sold time.Time) HoldingTerm {
+	if lot.AcquisitionType == InheritanceAcquisition {
+		return LongTerm
+	}
+	return ClassifyHoldingTerm(dateOf(lot.HoldingPeriodStart), sold)
+}
+
+// giftedBasis applies the dual basis rule to a sale of shares from a gifted lot whose fair market value on the date of
+// the gift was below the donor's basis. A sale for less than that value is a loss measured from it, held since the
+// date of the gift. A sale between the two bases has neither gain nor loss, and anything above uses the donor's basis
+// and holding period. basis and term are what the sale would use as a purchase, and are returned for other lots.
+func giftedBasis(lot *Data.TaxLot, shares Data.Quantity, basis int64, proceeds int64, sold time.Time,
+	term HoldingTerm) (int64, HoldingTerm) {
+	if lot.AcquisitionType != GiftAcquisition || lot.FairMarketValue == 0 {
+		return basis, term
+	}
+	lossBasis := basis - shares.MulPrice(lot.CostPerShare) + shares.MulPrice(lot.FairMarketValue)
+	if lossBasis >= basis {
+		return basis, term
+	}
+	if proceeds < lossBasis {
+		return lossBasis, ClassifyHoldingTerm(dateOf(lot.AcquisitionDate), sold)
+	}
+	if proceeds < basis {
+		return proceeds, term
+	}
+	return basis, term
+}
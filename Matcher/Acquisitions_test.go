@@ -0,0 +1,88 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"testing"
+)
+
+// acquiredLot builds a lot of 10 shares at $100 a share received by acquisitionType at the start of the acquired trade
+// date and held since the start of the holdingStart trade date
+func acquiredLot(acquisitionType string, acquired string, holdingStart string) *Data.TaxLot {
+	lot := testLot(1, 101, acquired, 10, 100_00)
+	lot.AcquisitionType = acquisitionType
+	lot.AcquisitionDate = startOfTradeDate(lot.AcquisitionDate)
+	lot.HoldingPeriodStart = startOfTradeDate(parseDate(holdingStart))
+	return lot
+}
+
+func TestGiftedBasis(t *testing.T) {
+	// 10 shares the donor bought for $100 a share in 2020, worth $60 a share when given on January 10th, 2024
+	giftLot := func(acquisitionType string, fairMarketValue int64) *Data.TaxLot {
+		lot := acquiredLot(acquisitionType, "2024-01-10", "2020-03-01")
+		lot.FairMarketValue = fairMarketValue
+		return lot
+	}
+	tests := []struct {
+		name      string
+		lot       *Data.TaxLot
+		basis     int64
+		proceeds  int64
+		sold      string
+		wantBasis int64
+		wantTerm  HoldingTerm
+	}{
+		{name: "sold below the value at the gift is a loss from that value held since the gift",
+			lot: giftLot(GiftAcquisition, 60_00), basis: 1_000_00, proceeds: 500_00, sold: "2024-06-01",
+			wantBasis: 600_00, wantTerm: ShortTerm},
+		{name: "loss from the value at the gift on the anniversary of the gift",
+			lot: giftLot(GiftAcquisition, 60_00), basis: 1_000_00, proceeds: 500_00, sold: "2025-01-10",
+			wantBasis: 600_00, wantTerm: ShortTerm},
+		{name: "loss from the value at the gift held over a year since the gift",
+			lot: giftLot(GiftAcquisition, 60_00), basis: 1_000_00, proceeds: 500_00, sold: "2025-01-11",
+			wantBasis: 600_00, wantTerm: LongTerm},
+		{name: "sold between the two bases has no gain or loss", lot: giftLot(GiftAcquisition, 60_00),
+			basis: 1_000_00, proceeds: 800_00, sold: "2024-06-01", wantBasis: 800_00, wantTerm: LongTerm},
+		{name: "sold at the value at the gift", lot: giftLot(GiftAcquisition, 60_00), basis: 1_000_00,
+			proceeds: 600_00, sold: "2024-06-01", wantBasis: 600_00, wantTerm: LongTerm},
+		{name: "sold above the donor's basis uses it and the donor's holding period",
+			lot: giftLot(GiftAcquisition, 60_00), basis: 1_000_00, proceeds: 1_200_00, sold: "2024-06-01",
+			wantBasis: 1_000_00, wantTerm: LongTerm},
+		{name: "basis adjustments carry into the loss basis", lot: giftLot(GiftAcquisition, 60_00),
+			basis: 1_050_00, proceeds: 500_00, sold: "2024-06-01", wantBasis: 650_00, wantTerm: ShortTerm},
+		{name: "value at the gift above the donor's basis", lot: giftLot(GiftAcquisition, 150_00),
+			basis: 1_000_00, proceeds: 500_00, sold: "2024-06-01", wantBasis: 1_000_00, wantTerm: LongTerm},
+		{name: "value at the gift not recorded", lot: giftLot(GiftAcquisition, 0), basis: 1_000_00,
+			proceeds: 500_00, sold: "2024-06-01", wantBasis: 1_000_00, wantTerm: LongTerm},
+		{name: "purchased shares", lot: giftLot(PurchaseAcquisition, 60_00), basis: 1_000_00, proceeds: 500_00,
+			sold: "2024-06-01", wantBasis: 1_000_00, wantTerm: LongTerm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basis, term := giftedBasis(tt.lot, Data.Shares(10), tt.basis, tt.proceeds, parseDate(tt.sold), LongTerm)
+			if basis != tt.wantBasis || term != tt.wantTerm {
+				t.Errorf("giftedBasis() = %d, %s, want %d, %s", basis, term, tt.wantBasis, tt.wantTerm)
+			}
+		})
+	}
+}
+
+func TestLotHoldingTerm(t *testing.T) {
+	tests := []struct {
+		name            string
+		acquisitionType string
+		holdingStart    string
+		want            HoldingTerm
+	}{
+		{"purchased a month before", PurchaseAcquisition, "2024-05-01", ShortTerm},
+		{"gift keeps the donor's holding period", GiftAcquisition, "2020-03-01", LongTerm},
+		{"inherited shares are always long term", InheritanceAcquisition, "2024-05-01", LongTerm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lot := acquiredLot(tt.acquisitionType, "2024-05-01", tt.holdingStart)
+			if got := lotHoldingTerm(lot, parseDate("2024-06-01")); got != tt.want {
+				t.Errorf("lotHoldingTerm() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"time"
+)
+
+// Filing statuses
+const (
+	Single                    = "SINGLE"
+	MarriedFilingJointly      = "MFJ"
+	MarriedFilingSeparately   = "MFS"
+	HeadOfHousehold           = "HOH"
+	QualifyingSurvivingSpouse = "QSS"
+)
+
+// capitalLossLimit is the most net capital loss that can be deducted against ordinary income in a year, in cents.
+// Married couples filing separate returns get half of it each.
+const capitalLossLimit = 300_000
+
+// ValidFilingStatus reports whether status is one of the filing statuses
+func ValidFilingStatus(status string) bool {
+	switch status {
+	case Single, MarriedFilingJointly, MarriedFilingSeparately, HeadOfHousehold, QualifyingSurvivingSpouse:
+		return true
+	}
+	return false
+}
+
+// deductionLimit returns the capital loss deduction limit for a filing status
+func deductionLimit(filingStatus string) int64 {
+	if filingStatus == MarriedFilingSeparately {
+		return capitalLossLimit / 2
+	}
+	return capitalLossLimit
+}
+
+// ComputeCapitalLossCarryovers works through the account's tax years oldest first. Each year's short and long term
+// results are netted with the losses carried into it as on Schedule D lines 7, 15 and 16, a net loss is deducted up
+// to the limit for the account's filing status, and the Capital Loss Carryover Worksheet splits what is left into the
+// short and long term losses carried into the next year. Years without realized gains still use up carryover, so the
+// walk continues through the current tax year. The carryovers and deducted loss of every year and the worksheets are
+// stored and the worksheets returned.
+func ComputeCapitalLossCarryovers(db *Data.DatabaseHelper, accountId int) ([]Data.CapitalLossCarryoverWorksheet,
+	error) {
+	balances, err := db.GetCapitalGainsBalancesByAccountID(accountId)
+	if err != nil {
+		return nil, err
+	}
+	if len(balances) == 0 {
+		return nil, db.ReplaceCapitalLossCarryoverWorksheets(accountId, nil)
+	}
+	taxableIncomes, err := db.GetTaxableIncomes(accountId)
+	if err != nil {
+		return nil, err
+	}
+	filingStatus, err := db.GetFilingStatus(accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	byYear := make(map[int]Data.CapitalGainsBalance)
+	for _, balance := range balances {
+		byYear[balance.TaxYear] = balance
+	}
+	lastYear := max(balances[len(balances)-1].TaxYear, TaxYear(time.Now()))
+
+	var worksheets []Data.CapitalLossCarryoverWorksheet
+	var shortTermCarryover, longTermCarryover int64
+	for taxYear := balances[0].TaxYear; taxYear <= lastYear; taxYear++ {
+		balance, ok := byYear[taxYear]
+		shortTermNet := balance.ShortTermChange - shortTermCarryover
+		longTermNet := balance.LongTermChange - longTermCarryover
+		var deductedLoss int64
+		if net := shortTermNet + longTermNet; net < 0 {
+			deductedLoss = min(-net, deductionLimit(filingStatus))
+		}
+
+		if ok || shortTermCarryover != 0 || longTermCarryover != 0 {
+			err := db.SetCapitalLossCarryover(accountId, taxYear, shortTermCarryover, longTermCarryover, deductedLoss)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var taxableIncome *int64
+		if income, ok := taxableIncomes[taxYear]; ok {
+			taxableIncome = &income
+		}
+		worksheet := carryoverWorksheet(taxYear+1, filingStatus, taxableIncome, deductedLoss, shortTermNet,
+			longTermNet)
+		worksheet.AccountId = accountId
+		shortTermCarryover, longTermCarryover = worksheet.Line8, worksheet.Line13
+		if shortTermNet+longTermNet < 0 {
+			worksheets = append(worksheets, worksheet)
+		}
+	}
+
+	if err := db.ReplaceCapitalLossCarryoverWorksheets(accountId, worksheets); err != nil {
+		return nil, err
+	}
+	return worksheets, nil
+}
+
+// carryoverWorksheet fills in the Capital Loss Carryover Worksheet for taxYear from the prior year's taxable income,
+// the loss deducted on its Schedule D line 21 and its net short and long term results from lines 7 and 15
+func carryoverWorksheet(taxYear int, filingStatus string, taxableIncome *int64, deductedLoss int64,
+	shortTermNet int64, longTermNet int64) Data.CapitalLossCarryoverWorksheet {
+	w := Data.CapitalLossCarryoverWorksheet{
+		TaxYear:      taxYear,
+		FilingStatus: filingStatus,
+		Line1:        taxableIncome,
+		Line2:        deductedLoss,
+	}
+	if taxableIncome != nil {
+		w.Line3 = max(*taxableIncome+w.Line2, 0)
+	} else {
+		w.Line3 = w.Line2
+	}
+	w.Line4 = min(w.Line2, w.Line3)
+	w.Line5 = max(-shortTermNet, 0)
+	w.Line6 = max(longTermNet, 0)
+	w.Line7 = w.Line4 + w.Line6
+	w.Line8 = max(w.Line5-w.Line7, 0)
+	w.Line9 = max(-longTermNet, 0)
+	w.Line10 = max(shortTermNet, 0)
+	w.Line11 = max(w.Line7-w.Line5, 0)
+	w.Line12 = w.Line10 + w.Line11
+	w.Line13 = max(w.Line9-w.Line12, 0)
+	return w
+}
@@ -0,0 +1,70 @@
+package Matcher
+
+import "testing"
+
+func TestCarryoverWorksheet(t *testing.T) {
+	income := func(dollars int64) *int64 {
+		cents := dollars * 100
+		return &cents
+	}
+	tests := []struct {
+		name          string
+		filingStatus  string
+		taxableIncome *int64
+		shortTermNet  int64
+		longTermNet   int64
+		wantDeducted  int64
+		wantLine4     int64
+		wantShortTerm int64
+		wantLongTerm  int64
+	}{
+		{name: "short-term loss above the limit", filingStatus: Single, taxableIncome: income(50_000),
+			shortTermNet: -10_000_00, wantDeducted: 3_000_00, wantLine4: 3_000_00, wantShortTerm: 7_000_00},
+		{name: "long-term loss offset by a short-term gain", filingStatus: Single, taxableIncome: income(50_000),
+			shortTermNet: 2_000_00, longTermNet: -9_000_00, wantDeducted: 3_000_00, wantLine4: 3_000_00,
+			wantLongTerm: 4_000_00},
+		{name: "both losses use up the short-term loss first", filingStatus: MarriedFilingJointly,
+			taxableIncome: income(80_000), shortTermNet: -2_000_00, longTermNet: -5_000_00,
+			wantDeducted: 3_000_00, wantLine4: 3_000_00, wantLongTerm: 4_000_00},
+		{name: "short-term loss offset by a long-term gain", filingStatus: HeadOfHousehold,
+			taxableIncome: income(50_000), shortTermNet: -10_000_00, longTermNet: 4_000_00,
+			wantDeducted: 3_000_00, wantLine4: 3_000_00, wantShortTerm: 3_000_00},
+		{name: "married filing separately limit", filingStatus: MarriedFilingSeparately,
+			taxableIncome: income(40_000), shortTermNet: -10_000_00, wantDeducted: 1_500_00, wantLine4: 1_500_00,
+			wantShortTerm: 8_500_00},
+		{name: "negative taxable income uses only part of the deduction", filingStatus: Single,
+			taxableIncome: income(-1_000), shortTermNet: -10_000_00, wantDeducted: 3_000_00, wantLine4: 2_000_00,
+			wantShortTerm: 8_000_00},
+		{name: "taxable income below minus the deduction uses none of it", filingStatus: Single,
+			taxableIncome: income(-5_000), shortTermNet: -6_000_00, longTermNet: -4_000_00,
+			wantDeducted: 3_000_00, wantShortTerm: 6_000_00, wantLongTerm: 4_000_00},
+		{name: "unknown taxable income assumes the deduction was used", filingStatus: Single,
+			shortTermNet: -10_000_00, wantDeducted: 3_000_00, wantLine4: 3_000_00, wantShortTerm: 7_000_00},
+		{name: "loss within the limit leaves no carryover", filingStatus: Single, taxableIncome: income(50_000),
+			shortTermNet: -1_000_00, longTermNet: -1_500_00, wantDeducted: 2_500_00, wantLine4: 2_500_00},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deductedLoss := min(-(tt.shortTermNet + tt.longTermNet), deductionLimit(tt.filingStatus))
+			if deductedLoss != tt.wantDeducted {
+				t.Fatalf("deducted loss = %d, want %d", deductedLoss, tt.wantDeducted)
+			}
+			w := carryoverWorksheet(2025, tt.filingStatus, tt.taxableIncome, deductedLoss, tt.shortTermNet,
+				tt.longTermNet)
+			if w.TaxYear != 2025 || w.Line2 != deductedLoss {
+				t.Errorf("worksheet for %d with line 2 %d, want 2025 and %d", w.TaxYear, w.Line2, deductedLoss)
+			}
+			if w.Line4 != tt.wantLine4 {
+				t.Errorf("line 4 = %d, want %d", w.Line4, tt.wantLine4)
+			}
+			if w.Line8 != tt.wantShortTerm || w.Line13 != tt.wantLongTerm {
+				t.Errorf("carryover = %d short-term and %d long-term, want %d and %d", w.Line8, w.Line13,
+					tt.wantShortTerm, tt.wantLongTerm)
+			}
+			// Whatever of the net loss was not used against income carries over
+			if net := tt.shortTermNet + tt.longTermNet; net < 0 && w.Line8+w.Line13 != -net-w.Line4 {
+				t.Errorf("carryover totals %d, want %d", w.Line8+w.Line13, -net-w.Line4)
+			}
+		})
+	}
+}
@@ -0,0 +1,524 @@
+package Matcher
+
+import (
+	"errors"
+	"fmt"
+	"gains/Data"
+	"log"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// Corporate action types
+const (
+	SplitAction        = "SPLIT"
+	TickerChangeAction = "TICKER_CHANGE"
+	// MergerAction is a reorganization: lots carry over to the acquirer and cash paid alongside the stock is taxed
+	// only up to the gain the exchange realizes
+	MergerAction = "MERGER"
+	// TaxableMergerAction is a merger that sells the old shares for the cash and the new stock received
+	TaxableMergerAction = "TAXABLE_MERGER"
+	SpinOffAction       = "SPIN_OFF"
+)
+
+// fullBasisAllocation is a BasisAllocation that gives the whole basis to the new security
+const fullBasisAllocation = 1_000_000
+
+// RecordStockSplit records a splitFrom-for-splitTo split of a ticker, e.g. 1 and 4 for a 4-for-1 split or 10 and 1 for
+// a 1-for-10 reverse split, and applies it to every account. A cashInLieuPrice in cents sells the fractional share
+// left over from a position at that price, 0 keeps fractional shares.
+func RecordStockSplit(db *Data.DatabaseHelper, ticker string, effectiveDate time.Time, splitFrom int, splitTo int,
+	cashInLieuPrice int64) (Data.CorporateAction, error) {
+	return RecordCorporateAction(db, Data.CorporateAction{
+		ActionType:      SplitAction,
+		StockTicker:     ticker,
+		EffectiveDate:   effectiveDate,
+		SplitFrom:       splitFrom,
+		SplitTo:         splitTo,
+		CashInLieuPrice: cashInLieuPrice,
+	})
+}
+
+// RecordCorporateAction validates and records a corporate action and applies it to every account. Accounts that
+// already matched activity in the security on or after the effective date are recomputed so those sales see the
+// adjusted lots.
+func RecordCorporateAction(db *Data.DatabaseHelper, action Data.CorporateAction) (Data.CorporateAction, error) {
+	if err := validateCorporateAction(&action); err != nil {
+		return Data.CorporateAction{}, err
+	}
+	year, month, day := action.EffectiveDate.Date()
+	action.EffectiveDate = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	action, err := db.InsertCorporateAction(action)
+	if err != nil {
+		return Data.CorporateAction{}, err
+	}
+	return action, applyToAccounts(db, action)
+}
+
+// validateCorporateAction checks that an action has what its type needs and fills in the default 1:1 share ratio
+func validateCorporateAction(action *Data.CorporateAction) error {
+	if action.StockTicker == "" {
+		return errors.New("a corporate action needs the ticker it applies to")
+	}
+	if action.SplitFrom == 0 {
+		action.SplitFrom = 1
+	}
+	if action.SplitTo == 0 {
+		action.SplitTo = 1
+	}
+	if action.SplitFrom < 0 || action.SplitTo < 0 {
+		return fmt.Errorf("invalid share ratio %d:%d", action.SplitTo, action.SplitFrom)
+	}
+
+	switch action.ActionType {
+	case SplitAction:
+	case TickerChangeAction:
+		if action.NewStockTicker == "" {
+			return errors.New("a ticker change needs the new ticker")
+		}
+	case MergerAction, TaxableMergerAction:
+		switch {
+		case action.NewStockTicker == "" && action.CashPerShare == 0:
+			return errors.New("a merger needs the new ticker, the cash per share or both")
+		case action.NewStockTicker == "" || (action.CashPerShare == 0 && action.ActionType == MergerAction):
+		case action.NewStockPrice <= 0:
+			return errors.New("a taxable or cash and stock merger needs the fair market value of the new stock")
+		}
+	case SpinOffAction:
+		if action.NewStockTicker == "" {
+			return errors.New("a spin-off needs the ticker of the spun-off company")
+		}
+		if action.BasisAllocation <= 0 || action.BasisAllocation >= fullBasisAllocation {
+			return errors.New("a spin-off needs the share of basis allocated to the spun-off company")
+		}
+	default:
+		return fmt.Errorf("unknown corporate action type %q", action.ActionType)
+	}
+	return nil
+}
+
+// applyToAccounts brings every account up to date with a newly recorded corporate action
+func applyToAccounts(db *Data.DatabaseHelper, action Data.CorporateAction) error {
+	accountIds, err := db.GetAccountIDs()
+	if err != nil {
+		return err
+	}
+	for _, accountId := range accountIds {
+		effective := startOfTradeDate(action.EffectiveDate)
+		stale, err := db.HasMatchedTransactionsAfter(accountId, action.StockTicker, effective)
+		if err != nil {
+			return err
+		}
+		if !stale && action.NewStockTicker != "" {
+			stale, err = db.HasMatchedTransactionsAfter(accountId, action.NewStockTicker, effective)
+			if err != nil {
+				return err
+			}
+		}
+		if stale {
+			slog.Info("Recomputing account for corporate action", "accountId", accountId,
+				"ticker", action.StockTicker, "actionId", action.ActionId)
+			if _, err := RecomputeAccount(db, accountId); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := MatchUnmatched(db, accountId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyCorporateActionsThrough applies the run's pending corporate actions effective on or before date. A corporate
+// action takes effect before the market opens on its effective date.
+func (m *matcher) applyCorporateActionsThrough(date time.Time) error {
+	for len(m.actions) > 0 && !m.actions[0].EffectiveDate.After(date) {
+		if err := m.applyCorporateAction(m.actions[0]); err != nil {
+			return err
+		}
+		m.actions = m.actions[1:]
+	}
+	return nil
+}
+
+// applyCorporateAction adjusts the account's lots for a corporate action and records that it was applied
+func (m *matcher) applyCorporateAction(action Data.CorporateAction) error {
+	var err error
+	switch action.ActionType {
+	case SplitAction:
+		err = m.applySplit(action)
+	case TickerChangeAction:
+		err = m.applyTickerChange(action)
+	case MergerAction:
+		err = m.applyMerger(action)
+	case TaxableMergerAction:
+		err = m.applyTaxableMerger(action)
+	case SpinOffAction:
+		err = m.applySpinOff(action)
+	default:
+		slog.Warn("Unknown corporate action type", "actionId", action.ActionId, "type", action.ActionType)
+	}
+	if err != nil {
+		return fmt.Errorf("error applying corporate action %d: %w", action.ActionId, err)
+	}
+	return m.db.MarkCorporateActionApplied(m.accountId, action.ActionId)
+}
+
+// lotsFor returns the open stock lots on a side that hold the action's security and were acquired before it took
+// effect, oldest first. Lots are matched on CUSIP when both the lot and the action have one, so lots still filed under
+// a ticker the security used to trade as are found too and refiled under the action's ticker.
+func (m *matcher) lotsFor(action Data.CorporateAction, side PositionSide) ([]*Data.TaxLot, error) {
+	var lots []*Data.TaxLot
+	for ticker, tickerLots := range m.lots[side] {
+		for _, lot := range tickerLots {
+			if lot.OpenQuantity == 0 || lot.Multiplier != 1 || !dateOf(lot.AcquisitionDate).Before(action.EffectiveDate) {
+				continue
+			}
+			if action.Cusip != "" && lot.Cusip != "" {
+				if lot.Cusip != action.Cusip {
+					continue
+				}
+			} else if ticker != action.StockTicker {
+				continue
+			}
+			lots = append(lots, lot)
+		}
+	}
+	sort.SliceStable(lots, func(i, j int) bool {
+		if lots[i].AcquisitionDate.Equal(lots[j].AcquisitionDate) {
+			return lots[i].LotId < lots[j].LotId
+		}
+		return lots[i].AcquisitionDate.Before(lots[j].AcquisitionDate)
+	})
+	for _, lot := range lots {
+		if lot.StockTicker != action.StockTicker {
+			if err := m.moveLot(lot, action.StockTicker, lot.Cusip); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return lots, nil
+}
+
+// moveLot refiles a lot under a new ticker and CUSIP and persists it
+func (m *matcher) moveLot(lot *Data.TaxLot, ticker string, cusip string) error {
+	side := PositionSide(lot.PositionSide)
+	tickerLots := m.lots[side][lot.StockTicker]
+	for i, l := range tickerLots {
+		if l == lot {
+			m.lots[side][lot.StockTicker] = append(tickerLots[:i:i], tickerLots[i+1:]...)
+			break
+		}
+	}
+	lot.StockTicker = ticker
+	lot.Cusip = cusip
+	m.lots[side][ticker] = append(m.lots[side][ticker], lot)
+	return m.db.UpdateTaxLot(*lot)
+}
+
+// scaleLot multiplies a lot's shares by splitTo / splitFrom and divides its cost per share by the same ratio. Whatever
+// the per share price loses to rounding is moved into the basis adjustment so the lot's total basis is unchanged.
+func scaleLot(lot *Data.TaxLot, splitFrom int, splitTo int) {
+	basis := lot.OpenQuantity.MulPrice(lot.CostPerShare)
+	lot.OriginalQuantity = lot.OriginalQuantity.Scale(splitTo, splitFrom)
+	lot.OpenQuantity = lot.OpenQuantity.Scale(splitTo, splitFrom)
+	lot.CostPerShare = Data.ScalePrice(lot.CostPerShare, splitFrom, splitTo)
+	lot.FairMarketValue = Data.ScalePrice(lot.FairMarketValue, splitFrom, splitTo)
+	lot.BasisAdjustment += basis - lot.OpenQuantity.MulPrice(lot.CostPerShare)
+}
+
+// applySplit scales every stock lot acquired before the effective date by the split ratio. Lots keep their
+// acquisition date and holding period.
+func (m *matcher) applySplit(action Data.CorporateAction) error {
+	for _, side := range []PositionSide{LongPosition, ShortPosition} {
+		lots, err := m.lotsFor(action, side)
+		if err != nil {
+			return err
+		}
+		for _, lot := range lots {
+			scaleLot(lot, action.SplitFrom, action.SplitTo)
+			if err := m.db.UpdateTaxLot(*lot); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("Applied %d-for-%d split of %s effective %s", action.SplitTo, action.SplitFrom, action.StockTicker,
+		action.EffectiveDate.Format(time.DateOnly))
+	return m.cashInLieu(action, action.StockTicker)
+}
+
+// applyTickerChange refiles the lots of a security that changed its ticker or CUSIP so later activity under the new
+// ticker is matched against them
+func (m *matcher) applyTickerChange(action Data.CorporateAction) error {
+	for _, side := range []PositionSide{LongPosition, ShortPosition} {
+		lots, err := m.lotsFor(action, side)
+		if err != nil {
+			return err
+		}
+		for _, lot := range lots {
+			if err := m.moveLot(lot, action.NewStockTicker, action.NewCusip); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("Moved %s lots to %s effective %s", action.StockTicker, action.NewStockTicker,
+		action.EffectiveDate.Format(time.DateOnly))
+	return nil
+}
+
+// applyMerger converts lots of a company acquired in a reorganization. A cash merger sells every share at the cash
+// price. In a stock merger lots become lots of the acquirer at the exchange ratio, keeping their basis and holding
+// period. When both cash and stock are paid, long lots recognize gain on the cash before they carry over.
+func (m *matcher) applyMerger(action Data.CorporateAction) error {
+	if action.NewStockTicker == "" {
+		if err := m.closeForCash(action, LongPosition, "SELL"); err != nil {
+			return err
+		}
+		return m.closeForCash(action, ShortPosition, "BUY_TO_COVER")
+	}
+
+	for _, side := range []PositionSide{LongPosition, ShortPosition} {
+		lots, err := m.lotsFor(action, side)
+		if err != nil {
+			return err
+		}
+		for _, lot := range lots {
+			if action.CashPerShare > 0 && side == LongPosition {
+				if err := m.recognizeBoot(action, lot); err != nil {
+					return err
+				}
+			}
+			scaleLot(lot, action.SplitFrom, action.SplitTo)
+			if err := m.moveLot(lot, action.NewStockTicker, action.NewCusip); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("Merged %s into %s effective %s", action.StockTicker, action.NewStockTicker,
+		action.EffectiveDate.Format(time.DateOnly))
+	return m.cashInLieu(action, action.NewStockTicker)
+}
+
+// closeForCash closes every lot on a side of a company acquired for cash at the cash price per share
+func (m *matcher) closeForCash(action Data.CorporateAction, side PositionSide, orderType string) error {
+	lots, err := m.lotsFor(action, side)
+	if err != nil {
+		return err
+	}
+	var shares Data.Quantity
+	for _, lot := range lots {
+		shares += lot.OpenQuantity
+	}
+	if shares == 0 {
+		return nil
+	}
+	return m.closeLots(Data.TransactionData{
+		AccountId:    m.accountId,
+		StockTicker:  action.StockTicker,
+		ShareCount:   shares,
+		StockPrice:   action.CashPerShare,
+		OrderType:    orderType,
+		ActivityDate: startOfTradeDate(action.EffectiveDate),
+	}, side, 0, action.ActionId)
+}
+
+// applyTaxableMerger sells every long lot of a company acquired in a taxable merger for the cash and the fair market
+// value of the new stock received, and opens a lot of the acquirer for each at that value with a holding period
+// starting on the effective date. Short lots become short lots of the acquirer as in a stock merger.
+func (m *matcher) applyTaxableMerger(action Data.CorporateAction) error {
+	if action.NewStockTicker == "" {
+		return m.applyMerger(action)
+	}
+
+	lots, err := m.lotsFor(action, LongPosition)
+	if err != nil {
+		return err
+	}
+	var shares Data.Quantity
+	received := make([]Data.Quantity, len(lots))
+	for i, lot := range lots {
+		shares += lot.OpenQuantity
+		received[i] = lot.OpenQuantity.Scale(action.SplitTo, action.SplitFrom)
+	}
+	if shares > 0 {
+		_, stockValue := mergerConsideration(action, shares)
+		err := m.closeLots(Data.TransactionData{
+			AccountId:    m.accountId,
+			StockTicker:  action.StockTicker,
+			ShareCount:   shares,
+			StockPrice:   action.CashPerShare,
+			OrderType:    "SELL",
+			ActivityDate: startOfTradeDate(action.EffectiveDate),
+		}, LongPosition, stockValue, action.ActionId)
+		if err != nil {
+			return err
+		}
+	}
+	for i, lot := range lots {
+		if received[i] == 0 {
+			continue
+		}
+		newLot, err := m.db.InsertTaxLot(Data.TaxLot{
+			AccountId:        m.accountId,
+			ActivityId:       lot.ActivityId,
+			LegId:            lot.LegId,
+			StockTicker:      action.NewStockTicker,
+			Cusip:            action.NewCusip,
+			OriginalQuantity: received[i],
+			OpenQuantity:     received[i],
+			CostPerShare:     action.NewStockPrice,
+			AcquisitionDate:  startOfTradeDate(action.EffectiveDate),
+			ParentLotId:      lot.LotId,
+			PositionSide:     string(LongPosition),
+			Multiplier:       1,
+		})
+		if err != nil {
+			return err
+		}
+		m.addLots(&newLot)
+	}
+
+	shorts, err := m.lotsFor(action, ShortPosition)
+	if err != nil {
+		return err
+	}
+	for _, lot := range shorts {
+		scaleLot(lot, action.SplitFrom, action.SplitTo)
+		if err := m.moveLot(lot, action.NewStockTicker, action.NewCusip); err != nil {
+			return err
+		}
+	}
+	log.Printf("Sold %s for %s in a taxable merger effective %s", action.StockTicker, action.NewStockTicker,
+		action.EffectiveDate.Format(time.DateOnly))
+	return m.cashInLieu(action, action.NewStockTicker)
+}
+
+// recognizeBoot books the cash received for a lot in a reorganization paid in cash and stock. The gain the exchange
+// realizes is recognized up to the cash received and a loss is not recognized at all. The lot keeps its basis less
+// the cash plus the gain recognized, which carries over to the new stock.
+func (m *matcher) recognizeBoot(action Data.CorporateAction, lot *Data.TaxLot) error {
+	basis := lot.OpenQuantity.MulPrice(lot.CostPerShare) + lot.BasisAdjustment
+	cash, stockValue := mergerConsideration(action, lot.OpenQuantity)
+	gain := bootGain(basis, cash, stockValue)
+	lot.BasisAdjustment += gain - cash
+	// Donated shares keep the part of their value at the gift date that the new stock stands for
+	lot.FairMarketValue = Data.ScalePrice(lot.FairMarketValue, int(stockValue), int(cash+stockValue))
+	term := lotHoldingTerm(lot, action.EffectiveDate)
+	if m.markToMarket(startOfTradeDate(action.EffectiveDate)) {
+		term = Ordinary
+	}
+
+	err := m.db.InsertRealizedGain(Data.RealizedGain{
+		AccountId:         m.accountId,
+		LotId:             lot.LotId,
+		StockTicker:       action.StockTicker,
+		SellDate:          startOfTradeDate(action.EffectiveDate),
+		Quantity:          lot.OpenQuantity,
+		Proceeds:          cash,
+		CostBasis:         cash - gain,
+		Gain:              gain,
+		CostBasisMethod:   action.ActionType,
+		HoldingTerm:       string(term),
+		CorporateActionId: action.ActionId,
+	})
+	if err != nil {
+		return err
+	}
+	m.recognize(term, gain, startOfTradeDate(action.EffectiveDate))
+	return nil
+}
+
+// mergerConsideration returns the cash and the fair market value of the new stock received for shares of a merged
+// company
+func mergerConsideration(action Data.CorporateAction, shares Data.Quantity) (int64, int64) {
+	cash := shares.MulPrice(action.CashPerShare)
+	stockValue := shares.Scale(action.SplitTo, action.SplitFrom).MulPrice(action.NewStockPrice)
+	return cash, stockValue
+}
+
+// bootGain returns the gain recognized on cash received alongside stock in a reorganization: the gain realized on the
+// whole exchange, but no more than the cash, and nothing when the exchange realizes a loss
+func bootGain(basis int64, cash int64, stockValue int64) int64 {
+	realized := cash + stockValue - basis
+	return max(0, min(realized, cash))
+}
+
+// applySpinOff opens a lot of the spun-off company for every long lot of the parent acquired before the distribution.
+// The new lot gets the allocated share of the parent lot's basis, which the parent lot gives up, and keeps the parent
+// lot's acquisition date and holding period. Short positions are left alone.
+func (m *matcher) applySpinOff(action Data.CorporateAction) error {
+	lots, err := m.lotsFor(action, LongPosition)
+	if err != nil {
+		return err
+	}
+	for _, lot := range lots {
+		shares := lot.OpenQuantity.Scale(action.SplitTo, action.SplitFrom)
+		if shares == 0 {
+			continue
+		}
+		basis := lot.OpenQuantity.MulPrice(lot.CostPerShare) + lot.BasisAdjustment
+		allocated := Data.ScalePrice(basis, int(action.BasisAllocation), fullBasisAllocation)
+		lot.BasisAdjustment -= allocated
+		fairMarketValue := lot.OpenQuantity.MulPrice(lot.FairMarketValue)
+		allocatedValue := Data.ScalePrice(fairMarketValue, int(action.BasisAllocation), fullBasisAllocation)
+		lot.FairMarketValue = lot.OpenQuantity.PerShare(fairMarketValue - allocatedValue)
+		if err := m.db.UpdateTaxLot(*lot); err != nil {
+			return err
+		}
+
+		costPerShare := shares.PerShare(allocated)
+		spunOff, err := m.db.InsertTaxLot(Data.TaxLot{
+			AccountId:          m.accountId,
+			ActivityId:         lot.ActivityId,
+			LegId:              lot.LegId,
+			StockTicker:        action.NewStockTicker,
+			Cusip:              action.NewCusip,
+			OriginalQuantity:   shares,
+			OpenQuantity:       shares,
+			CostPerShare:       costPerShare,
+			AcquisitionDate:    lot.AcquisitionDate,
+			ParentLotId:        lot.LotId,
+			BasisAdjustment:    allocated - shares.MulPrice(costPerShare),
+			HoldingPeriodStart: lot.HoldingPeriodStart,
+			PositionSide:       string(LongPosition),
+			Multiplier:         1,
+			BasisUnknown:       lot.BasisUnknown,
+			AcquisitionType:    lot.AcquisitionType,
+			FairMarketValue:    shares.PerShare(allocatedValue),
+		})
+		if err != nil {
+			return err
+		}
+		m.addLots(&spunOff)
+	}
+	log.Printf("Spun off %s from %s effective %s", action.NewStockTicker, action.StockTicker,
+		action.EffectiveDate.Format(time.DateOnly))
+	return m.cashInLieu(action, action.NewStockTicker)
+}
+
+// cashInLieu sells the fractional share of a long position left over by a corporate action at the action's cash in
+// lieu price, if it pays one
+func (m *matcher) cashInLieu(action Data.CorporateAction, ticker string) error {
+	var shares Data.Quantity
+	for _, lot := range m.lots[LongPosition][ticker] {
+		if lot.Multiplier == 1 {
+			shares += lot.OpenQuantity
+		}
+	}
+	fraction := shares % Data.Shares(1)
+	if action.CashInLieuPrice == 0 || fraction == 0 {
+		return nil
+	}
+	return m.closeLots(Data.TransactionData{
+		AccountId:    m.accountId,
+		StockTicker:  ticker,
+		ShareCount:   fraction,
+		StockPrice:   action.CashInLieuPrice,
+		OrderType:    "SELL",
+		ActivityDate: startOfTradeDate(action.EffectiveDate),
+	}, LongPosition, 0, action.ActionId)
+}
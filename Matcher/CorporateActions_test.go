@@ -0,0 +1,164 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"testing"
+)
+
+func TestBootGain(t *testing.T) {
+	tests := []struct {
+		name       string
+		basis      int64
+		cash       int64
+		stockValue int64
+		want       int64
+	}{
+		{"gain above the cash is capped at the cash", 1_000_00, 300_00, 1_200_00, 300_00},
+		{"gain below the cash is recognized in full", 1_000_00, 300_00, 800_00, 100_00},
+		{"gain equal to the cash", 1_000_00, 300_00, 1_000_00, 300_00},
+		{"no gain or loss", 1_000_00, 300_00, 700_00, 0},
+		{"loss is never recognized", 1_000_00, 300_00, 500_00, 0},
+		{"zero basis", 0, 300_00, 700_00, 300_00},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bootGain(tt.basis, tt.cash, tt.stockValue); got != tt.want {
+				t.Errorf("bootGain(%d, %d, %d) = %d, want %d", tt.basis, tt.cash, tt.stockValue, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergerConsideration(t *testing.T) {
+	tests := []struct {
+		name          string
+		action        Data.CorporateAction
+		shares        Data.Quantity
+		originalBasis int64
+		wantCash      int64
+		wantStock     int64
+		wantProceeds  int64
+		wantNewBasis  int64
+	}{
+		{
+			name: "reorganization with boot and a gain above the cash",
+			action: Data.CorporateAction{ActionType: MergerAction, SplitFrom: 1, SplitTo: 2, CashPerShare: 10_00,
+				NewStockPrice: 25_00},
+			shares:        Data.Shares(100),
+			originalBasis: 4_000_00,
+			wantCash:      1_000_00,
+			wantStock:     5_000_00,
+			// $2,000 realized, $1,000 recognized, basis $4,000 - $1,000 + $1,000
+			wantNewBasis: 4_000_00,
+		},
+		{
+			name: "reorganization with boot and a realized loss",
+			action: Data.CorporateAction{ActionType: MergerAction, SplitFrom: 1, SplitTo: 2, CashPerShare: 10_00,
+				NewStockPrice: 25_00},
+			shares:        Data.Shares(100),
+			originalBasis: 8_000_00,
+			wantCash:      1_000_00,
+			wantStock:     5_000_00,
+			// $2,000 realized loss is not recognized, basis $8,000 - $1,000
+			wantNewBasis: 7_000_00,
+		},
+		{
+			name: "taxable merger sells for the cash and the new stock",
+			action: Data.CorporateAction{ActionType: TaxableMergerAction, SplitFrom: 4, SplitTo: 1,
+				CashPerShare: 5_00, NewStockPrice: 120_00},
+			shares:       Data.Shares(40),
+			wantCash:     200_00,
+			wantStock:    1_200_00,
+			wantProceeds: 1_400_00,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cash, stockValue := mergerConsideration(tt.action, tt.shares)
+			if cash != tt.wantCash || stockValue != tt.wantStock {
+				t.Fatalf("mergerConsideration() = %d, %d, want %d, %d", cash, stockValue, tt.wantCash, tt.wantStock)
+			}
+			if tt.action.ActionType == TaxableMergerAction {
+				if proceeds := cash + stockValue; proceeds != tt.wantProceeds {
+					t.Errorf("proceeds = %d, want %d", proceeds, tt.wantProceeds)
+				}
+				return
+			}
+			newBasis := tt.originalBasis - cash + bootGain(tt.originalBasis, cash, stockValue)
+			if newBasis != tt.wantNewBasis {
+				t.Errorf("new stock basis = %d, want %d", newBasis, tt.wantNewBasis)
+			}
+		})
+	}
+}
+
+func TestValidateMerger(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  Data.CorporateAction
+		wantErr bool
+	}{
+		{"cash merger", Data.CorporateAction{ActionType: MergerAction, CashPerShare: 50_00}, false},
+		{"stock reorganization without a price", Data.CorporateAction{ActionType: MergerAction,
+			NewStockTicker: "NEW"}, false},
+		{"reorganization with boot needs a price", Data.CorporateAction{ActionType: MergerAction,
+			NewStockTicker: "NEW", CashPerShare: 10_00}, true},
+		{"reorganization with boot", Data.CorporateAction{ActionType: MergerAction, NewStockTicker: "NEW",
+			CashPerShare: 10_00, NewStockPrice: 25_00}, false},
+		{"taxable stock merger needs a price", Data.CorporateAction{ActionType: TaxableMergerAction,
+			NewStockTicker: "NEW"}, true},
+		{"taxable stock and cash merger", Data.CorporateAction{ActionType: TaxableMergerAction,
+			NewStockTicker: "NEW", CashPerShare: 10_00, NewStockPrice: 25_00}, false},
+		{"taxable cash merger", Data.CorporateAction{ActionType: TaxableMergerAction, CashPerShare: 50_00}, false},
+		{"merger paying nothing", Data.CorporateAction{ActionType: TaxableMergerAction}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.action.StockTicker = "OLD"
+			err := validateCorporateAction(&tt.action)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateCorporateAction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScaleLot(t *testing.T) {
+	tests := []struct {
+		name             string
+		shares           Data.Quantity
+		costPerShare     int64
+		splitFrom        int
+		splitTo          int
+		wantShares       Data.Quantity
+		wantCostPerShare int64
+	}{
+		{"4-for-1 split", Data.Shares(25), 400_00, 1, 4, Data.Shares(100), 100_00},
+		{"1-for-10 reverse split", Data.Shares(25), 3_33, 10, 1, 2_500_000, 33_30},
+		{"3-for-2 split with rounding", Data.Shares(7), 100_01, 2, 3, 10_500_000, 66_67},
+		{"fractional shares", 333_333, 150_00, 1, 3, 999_999, 50_00},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lot := testLot(1, 101, "2024-01-10", 0, tt.costPerShare)
+			lot.OriginalQuantity, lot.OpenQuantity = tt.shares, tt.shares
+			lot.BasisAdjustment = 12_34
+			acquired := lot.AcquisitionDate
+			before := lot.OpenQuantity.MulPrice(lot.CostPerShare) + lot.BasisAdjustment
+
+			scaleLot(lot, tt.splitFrom, tt.splitTo)
+			if lot.OpenQuantity != tt.wantShares || lot.OriginalQuantity != tt.wantShares {
+				t.Errorf("shares = %s open of %s, want %s", lot.OpenQuantity, lot.OriginalQuantity, tt.wantShares)
+			}
+			if lot.CostPerShare != tt.wantCostPerShare {
+				t.Errorf("cost per share = %d, want %d", lot.CostPerShare, tt.wantCostPerShare)
+			}
+			if after := lot.OpenQuantity.MulPrice(lot.CostPerShare) + lot.BasisAdjustment; after != before {
+				t.Errorf("total basis went from %d to %d", before, after)
+			}
+			if !lot.AcquisitionDate.Equal(acquired) {
+				t.Errorf("acquisition date moved to %s", lot.AcquisitionDate)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"sort"
+	"time"
+)
+
+// CostBasisMethod decides which open lots a sale is matched against
+type CostBasisMethod string
+
+const (
+	FIFO       CostBasisMethod = "FIFO"
+	LIFO       CostBasisMethod = "LIFO"
+	HIFO       CostBasisMethod = "HIFO"
+	LowestCost CostBasisMethod = "LOWEST_COST"
+	SpecificId CostBasisMethod = "SPECIFIC_ID"
+	// AverageCost is the single category average cost method used for mutual fund shares
+	AverageCost CostBasisMethod = "AVERAGE_COST"
+)
+
+// Cost basis election scopes
+const (
+	SecurityScope  = "SECURITY"
+	AssetTypeScope = "ASSET_TYPE"
+)
+
+// ValidCostBasisMethod reports whether method is one of the cost basis methods
+func ValidCostBasisMethod(method string) bool {
+	switch CostBasisMethod(method) {
+	case FIFO, LIFO, HIFO, LowestCost, SpecificId, AverageCost:
+		return true
+	}
+	return false
+}
+
+// ParseCostBasisMethod converts a stored method name, falling back to FIFO for anything unrecognized
+func ParseCostBasisMethod(method string) CostBasisMethod {
+	switch CostBasisMethod(method) {
+	case FIFO, LIFO, HIFO, LowestCost, SpecificId, AverageCost:
+		return CostBasisMethod(method)
+	}
+	return FIFO
+}
+
+// lotAllocation is the number of shares a sale takes from a single lot along with their share of the lot's basis
+// adjustment
+type lotAllocation struct {
+	lot             *Data.TaxLot
+	quantity        Data.Quantity
+	basisAdjustment int64
+}
+
+// allocateLots picks the lots a sale consumes under the given method and decrements their open quantity and basis
+// adjustment. Only lots acquired on or before the sale are eligible. Under SPECIFIC_ID the designated lots are taken
+// first and any shares not covered by a selection fall back to FIFO, which is what Schwab does when no lot is
+// specified. AVERAGE_COST takes lots in FIFO order once averageLots has evened out their basis. The number of shares
+// that could not be matched to any lot is returned alongside the allocations.
+func allocateLots(sell Data.TransactionData, lots []*Data.TaxLot, method CostBasisMethod,
+	selections []Data.LotSelection) ([]lotAllocation, Data.Quantity) {
+	var allocations []lotAllocation
+	sharesToSell := sell.ShareCount
+
+	var eligible []*Data.TaxLot
+	for _, lot := range lots {
+		if lot.OpenQuantity > 0 && !lot.AcquisitionDate.After(sell.ActivityDate) {
+			eligible = append(eligible, lot)
+		}
+	}
+
+	take := func(lot *Data.TaxLot, quantity Data.Quantity) {
+		quantity = min(quantity, lot.OpenQuantity, sharesToSell)
+		if quantity <= 0 {
+			return
+		}
+		basisAdjustment := quantity.Portion(lot.BasisAdjustment, lot.OpenQuantity)
+		lot.BasisAdjustment -= basisAdjustment
+		lot.OpenQuantity -= quantity
+		sharesToSell -= quantity
+		allocations = append(allocations, lotAllocation{lot: lot, quantity: quantity, basisAdjustment: basisAdjustment})
+	}
+
+	if method == SpecificId {
+		for _, selection := range selections {
+			// A purchase may have been split into several lots, take the selected shares from them in FIFO order
+			remaining := selection.Quantity
+			for _, lot := range orderLots(eligible, FIFO) {
+				if lot.ActivityId == selection.LotActivityId && remaining > 0 {
+					before := sharesToSell
+					take(lot, remaining)
+					remaining -= before - sharesToSell
+				}
+			}
+		}
+		method = FIFO
+	}
+
+	for _, lot := range orderLots(eligible, method) {
+		if sharesToSell == 0 {
+			break
+		}
+		take(lot, sharesToSell)
+	}
+
+	return allocations, sharesToSell
+}
+
+// orderLots returns a copy of the lots sorted in the order the method consumes them. Ties are broken by
+// acquisition date so results are deterministic.
+func orderLots(lots []*Data.TaxLot, method CostBasisMethod) []*Data.TaxLot {
+	ordered := append([]*Data.TaxLot(nil), lots...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		switch method {
+		case LIFO:
+			return a.AcquisitionDate.After(b.AcquisitionDate)
+		case HIFO:
+			if a.CostPerShare != b.CostPerShare {
+				return a.CostPerShare > b.CostPerShare
+			}
+		case LowestCost:
+			if a.CostPerShare != b.CostPerShare {
+				return a.CostPerShare < b.CostPerShare
+			}
+		}
+		return a.AcquisitionDate.Before(b.AcquisitionDate)
+	})
+	return ordered
+}
+
+// averageLots spreads the total basis of the lots held at asOf evenly over their shares, the way the average cost
+// method values every share of a fund at the average of all shares held. Lots keep their quantity and holding period,
+// so a sale taking them in FIFO order still splits into short and long term by the shares actually sold. Each lot's
+// share of the total is carried as the average cost per share plus a basis adjustment for rounding, so the total basis
+// is unchanged. The lots that were changed are returned.
+func averageLots(lots []*Data.TaxLot, asOf time.Time) []*Data.TaxLot {
+	var held []*Data.TaxLot
+	var totalShares Data.Quantity
+	var totalBasis int64
+	for _, lot := range orderLots(lots, FIFO) {
+		if lot.OpenQuantity > 0 && lot.Multiplier == 1 && !lot.AcquisitionDate.After(asOf) {
+			held = append(held, lot)
+			totalShares += lot.OpenQuantity
+			totalBasis += lot.OpenQuantity.MulPrice(lot.CostPerShare) + lot.BasisAdjustment
+		}
+	}
+	if totalShares == 0 {
+		return nil
+	}
+
+	averageCost := totalShares.PerShare(totalBasis)
+	var before Data.Quantity
+	for _, lot := range held {
+		basis := prorate(totalBasis, totalShares, before, lot.OpenQuantity)
+		before += lot.OpenQuantity
+		lot.CostPerShare = averageCost
+		lot.BasisAdjustment = basis - lot.OpenQuantity.MulPrice(averageCost)
+	}
+	return held
+}
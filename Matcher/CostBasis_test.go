@@ -0,0 +1,221 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testLot builds an open long stock lot bought on date, a YYYY-MM-DD trade date
+func testLot(lotId int64, activityId int64, date string, shares int, costPerShare int64) *Data.TaxLot {
+	acquired, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		panic(err)
+	}
+	return &Data.TaxLot{
+		LotId:            lotId,
+		ActivityId:       activityId,
+		StockTicker:      "VTI",
+		OriginalQuantity: Data.Shares(shares),
+		OpenQuantity:     Data.Shares(shares),
+		CostPerShare:     costPerShare,
+		AcquisitionDate:  acquired,
+		PositionSide:     string(LongPosition),
+		Multiplier:       1,
+	}
+}
+
+// testLots returns three lots bought in January, February and March at $100, $120 and $90
+func testLots() []*Data.TaxLot {
+	return []*Data.TaxLot{
+		testLot(1, 101, "2024-01-10", 10, 100_00),
+		testLot(2, 102, "2024-02-10", 10, 120_00),
+		testLot(3, 103, "2024-03-10", 10, 90_00),
+	}
+}
+
+func lotIds(lots []*Data.TaxLot) []int64 {
+	var ids []int64
+	for _, lot := range lots {
+		ids = append(ids, lot.LotId)
+	}
+	return ids
+}
+
+func TestOrderLots(t *testing.T) {
+	tests := []struct {
+		method CostBasisMethod
+		want   []int64
+	}{
+		{FIFO, []int64{1, 2, 3}},
+		{LIFO, []int64{3, 2, 1}},
+		{HIFO, []int64{2, 1, 3}},
+		{LowestCost, []int64{3, 1, 2}},
+		{SpecificId, []int64{1, 2, 3}},
+		{AverageCost, []int64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.method), func(t *testing.T) {
+			lots := testLots()
+			if got := lotIds(orderLots(lots, tt.method)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orderLots(%s) = %v, want %v", tt.method, got, tt.want)
+			}
+			if got := lotIds(lots); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+				t.Errorf("orderLots reordered its input to %v", got)
+			}
+		})
+	}
+
+	// Lots at the same cost are taken oldest first
+	tied := []*Data.TaxLot{testLot(2, 102, "2024-02-10", 1, 50_00), testLot(1, 101, "2024-01-10", 1, 50_00)}
+	if got := lotIds(orderLots(tied, HIFO)); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("orderLots(HIFO) with tied costs = %v, want [1 2]", got)
+	}
+}
+
+func TestAllocateLots(t *testing.T) {
+	type allocation struct {
+		LotId    int64
+		Quantity Data.Quantity
+	}
+	tests := []struct {
+		name          string
+		method        CostBasisMethod
+		shares        int
+		date          string
+		selections    []Data.LotSelection
+		want          []allocation
+		wantUnmatched Data.Quantity
+	}{
+		{name: "FIFO", method: FIFO, shares: 15, date: "2024-04-01",
+			want: []allocation{{1, Data.Shares(10)}, {2, Data.Shares(5)}}},
+		{name: "LIFO", method: LIFO, shares: 15, date: "2024-04-01",
+			want: []allocation{{3, Data.Shares(10)}, {2, Data.Shares(5)}}},
+		{name: "HIFO", method: HIFO, shares: 15, date: "2024-04-01",
+			want: []allocation{{2, Data.Shares(10)}, {1, Data.Shares(5)}}},
+		{name: "LOWEST_COST", method: LowestCost, shares: 15, date: "2024-04-01",
+			want: []allocation{{3, Data.Shares(10)}, {1, Data.Shares(5)}}},
+		{name: "AVERAGE_COST takes lots in FIFO order", method: AverageCost, shares: 15, date: "2024-04-01",
+			want: []allocation{{1, Data.Shares(10)}, {2, Data.Shares(5)}}},
+		{name: "lots bought after the sale are not eligible", method: LIFO, shares: 15, date: "2024-02-20",
+			want: []allocation{{2, Data.Shares(10)}, {1, Data.Shares(5)}}},
+		{name: "shares beyond the open lots are unmatched", method: FIFO, shares: 35, date: "2024-04-01",
+			want:          []allocation{{1, Data.Shares(10)}, {2, Data.Shares(10)}, {3, Data.Shares(10)}},
+			wantUnmatched: Data.Shares(5)},
+		{name: "SPECIFIC_ID takes the selected lots", method: SpecificId, shares: 12, date: "2024-04-01",
+			selections: []Data.LotSelection{{LotActivityId: 103, Quantity: Data.Shares(8)},
+				{LotActivityId: 102, Quantity: Data.Shares(4)}},
+			want: []allocation{{3, Data.Shares(8)}, {2, Data.Shares(4)}}},
+		{name: "SPECIFIC_ID falls back to FIFO for shares not selected", method: SpecificId, shares: 12,
+			date: "2024-04-01", selections: []Data.LotSelection{{LotActivityId: 103, Quantity: Data.Shares(5)}},
+			want: []allocation{{3, Data.Shares(5)}, {1, Data.Shares(7)}}},
+		{name: "SPECIFIC_ID without selections is FIFO", method: SpecificId, shares: 12, date: "2024-04-01",
+			want: []allocation{{1, Data.Shares(10)}, {2, Data.Shares(2)}}},
+		{name: "SPECIFIC_ID selecting more than the lot holds", method: SpecificId, shares: 12, date: "2024-04-01",
+			selections: []Data.LotSelection{{LotActivityId: 102, Quantity: Data.Shares(20)}},
+			want:       []allocation{{2, Data.Shares(10)}, {1, Data.Shares(2)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sold, _ := time.Parse(time.DateOnly, tt.date)
+			lots := testLots()
+			sell := Data.TransactionData{ShareCount: Data.Shares(tt.shares), ActivityDate: sold, OrderType: "SELL"}
+			allocations, unmatched := allocateLots(sell, lots, tt.method, tt.selections)
+
+			var got []allocation
+			for _, a := range allocations {
+				got = append(got, allocation{a.lot.LotId, a.quantity})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocateLots() = %v, want %v", got, tt.want)
+			}
+			if unmatched != tt.wantUnmatched {
+				t.Errorf("allocateLots() unmatched = %s, want %s", unmatched, tt.wantUnmatched)
+			}
+			for _, a := range allocations {
+				if a.lot.OpenQuantity < 0 {
+					t.Errorf("lot %d left with %s open shares", a.lot.LotId, a.lot.OpenQuantity)
+				}
+			}
+		})
+	}
+}
+
+func TestAllocateLotsSplitsBasisAdjustment(t *testing.T) {
+	lot := testLot(1, 101, "2024-01-10", 3, 100_00)
+	lot.BasisAdjustment = 100
+	sell := Data.TransactionData{ShareCount: Data.Shares(1), ActivityDate: lot.AcquisitionDate.AddDate(0, 1, 0)}
+
+	var taken int64
+	for i := 0; i < 3; i++ {
+		allocations, _ := allocateLots(sell, []*Data.TaxLot{lot}, FIFO, nil)
+		taken += allocations[0].basisAdjustment
+	}
+	if taken != 100 || lot.BasisAdjustment != 0 || lot.OpenQuantity != 0 {
+		t.Errorf("sales took %d of the basis adjustment leaving %d on %s shares, want 100, 0 and 0", taken,
+			lot.BasisAdjustment, lot.OpenQuantity)
+	}
+}
+
+func TestAverageLots(t *testing.T) {
+	asOf, _ := time.Parse(time.DateOnly, "2024-04-01")
+	tests := []struct {
+		name        string
+		lots        []*Data.TaxLot
+		wantChanged []int64
+		wantAverage int64
+	}{
+		{name: "even average", lots: testLots(), wantChanged: []int64{1, 2, 3}, wantAverage: 103_33},
+		{name: "rounding is kept in the basis adjustment", lots: []*Data.TaxLot{
+			testLot(1, 101, "2024-01-10", 1, 100_00),
+			testLot(2, 102, "2024-02-10", 1, 100_00),
+			testLot(3, 103, "2024-03-10", 1, 100_01),
+		}, wantChanged: []int64{1, 2, 3}, wantAverage: 100_00},
+		{name: "fractional shares and basis adjustments", lots: func() []*Data.TaxLot {
+			lots := testLots()
+			lots[0].OpenQuantity = 2_345_678
+			lots[1].BasisAdjustment = 7_77
+			lots[2].OpenQuantity = 333_333
+			return lots
+		}(), wantChanged: []int64{1, 2, 3}, wantAverage: 116_12},
+		{name: "lots bought after asOf are left alone", lots: append(testLots(),
+			testLot(4, 104, "2024-05-10", 10, 500_00)), wantChanged: []int64{1, 2, 3}, wantAverage: 103_33},
+		{name: "closed lots and options are left alone", lots: func() []*Data.TaxLot {
+			lots := testLots()
+			lots[0].OpenQuantity = 0
+			lots[1].Multiplier = contractMultiplier
+			return lots
+		}(), wantChanged: []int64{3}, wantAverage: 90_00},
+		{name: "nothing held", lots: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before int64
+			for _, lot := range tt.lots {
+				if !lot.AcquisitionDate.After(asOf) && lot.Multiplier == 1 {
+					before += lot.OpenQuantity.MulPrice(lot.CostPerShare) + lot.BasisAdjustment
+				}
+			}
+
+			changed := averageLots(tt.lots, asOf)
+			if got := lotIds(changed); !reflect.DeepEqual(got, tt.wantChanged) {
+				t.Fatalf("averageLots() changed lots %v, want %v", got, tt.wantChanged)
+			}
+			var after int64
+			for _, lot := range tt.lots {
+				if !lot.AcquisitionDate.After(asOf) && lot.Multiplier == 1 {
+					after += lot.OpenQuantity.MulPrice(lot.CostPerShare) + lot.BasisAdjustment
+				}
+			}
+			if after != before {
+				t.Errorf("total basis went from %d to %d", before, after)
+			}
+			for _, lot := range changed {
+				if lot.CostPerShare != tt.wantAverage {
+					t.Errorf("lot %d cost per share = %d, want %d", lot.LotId, lot.CostPerShare, tt.wantAverage)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package Matcher
+
+import (
+	"errors"
+	"fmt"
+	"gains/Data"
+	"log/slog"
+)
+
+// Dividend types
+const (
+	QualifiedDividend = "QUALIFIED"
+	OrdinaryDividend  = "ORDINARY"
+)
+
+// RecordDividend records a dividend as income and, when it was reinvested, a REINVEST transaction under the same
+// activity id that opens a lot for the shares it bought. Recording a dividend that is already stored does nothing.
+// Reinvested shares can be replacement shares for an earlier loss, so an account that already matched activity in
+// the ticker on or after the pay date is recomputed.
+func RecordDividend(db *Data.DatabaseHelper, dividend Data.Dividend) (Data.Dividend, error) {
+	if err := validateDividend(dividend); err != nil {
+		return Data.Dividend{}, err
+	}
+
+	// A pay date given as a calendar date is paid on that trade date
+	dividend.PayDate = startOfTradeDate(dividend.PayDate)
+	dividend, inserted, err := db.InsertDividend(dividend)
+	if err != nil {
+		return Data.Dividend{}, err
+	}
+	if !inserted || dividend.ReinvestedQuantity == 0 {
+		return dividend, nil
+	}
+
+	_, err = db.InsertManualTransaction(reinvestment(dividend))
+	if err != nil {
+		return Data.Dividend{}, err
+	}
+
+	stale, err := db.HasMatchedTransactionsAfter(dividend.AccountId, dividend.StockTicker,
+		dividend.PayDate)
+	if err != nil {
+		return Data.Dividend{}, err
+	}
+	if stale {
+		slog.Info("Recomputing account for reinvested dividend", "accountId", dividend.AccountId,
+			"ticker", dividend.StockTicker, "activityId", dividend.ActivityId)
+		_, err := RecomputeAccount(db, dividend.AccountId)
+		return dividend, err
+	}
+
+	if _, err := MatchUnmatched(db, dividend.AccountId); err != nil {
+		return Data.Dividend{}, err
+	}
+	return dividend, nil
+}
+
+// validateDividend checks that a dividend names its ticker and type and does not reinvest a negative amount
+func validateDividend(dividend Data.Dividend) error {
+	if dividend.StockTicker == "" {
+		return errors.New("a dividend needs the ticker that paid it")
+	}
+	if dividend.DividendType != QualifiedDividend && dividend.DividendType != OrdinaryDividend {
+		return fmt.Errorf("unknown dividend type %q", dividend.DividendType)
+	}
+	if dividend.ReinvestedQuantity < 0 || dividend.ReinvestPrice < 0 {
+		return fmt.Errorf("invalid reinvestment of %s shares at %d", dividend.ReinvestedQuantity,
+			dividend.ReinvestPrice)
+	}
+	return nil
+}
+
+// reinvestment is the REINVEST transaction that buys a dividend's reinvested shares on its pay date
+func reinvestment(dividend Data.Dividend) Data.TransactionData {
+	return Data.TransactionData{
+		AccountId:    dividend.AccountId,
+		ActivityId:   dividend.ActivityId,
+		StockTicker:  dividend.StockTicker,
+		Cusip:        dividend.Cusip,
+		ShareCount:   dividend.ReinvestedQuantity,
+		StockPrice:   dividend.ReinvestPrice,
+		OrderType:    "REINVEST",
+		ActivityDate: dividend.PayDate,
+	}
+}
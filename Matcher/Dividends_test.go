@@ -0,0 +1,73 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"strings"
+	"testing"
+)
+
+func TestValidateDividend(t *testing.T) {
+	valid := Data.Dividend{StockTicker: "VTI", DividendType: QualifiedDividend, Amount: 12_34}
+	tests := []struct {
+		name    string
+		change  func(*Data.Dividend)
+		wantErr string
+	}{
+		{name: "qualified dividend paid in cash", change: func(*Data.Dividend) {}},
+		{name: "ordinary dividend reinvested", change: func(d *Data.Dividend) {
+			d.DividendType = OrdinaryDividend
+			d.ReinvestedQuantity = 54_321
+			d.ReinvestPrice = 227_15
+		}},
+		{name: "missing ticker", change: func(d *Data.Dividend) { d.StockTicker = "" },
+			wantErr: "needs the ticker"},
+		{name: "unknown type", change: func(d *Data.Dividend) { d.DividendType = "SPECIAL" },
+			wantErr: `unknown dividend type "SPECIAL"`},
+		{name: "negative reinvested shares", change: func(d *Data.Dividend) { d.ReinvestedQuantity = -1 },
+			wantErr: "invalid reinvestment"},
+		{name: "negative reinvest price", change: func(d *Data.Dividend) { d.ReinvestPrice = -1 },
+			wantErr: "invalid reinvestment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dividend := valid
+			tt.change(&dividend)
+			err := validateDividend(dividend)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateDividend() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateDividend() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReinvestment(t *testing.T) {
+	dividend := Data.Dividend{
+		AccountId:          7,
+		ActivityId:         555,
+		StockTicker:        "VTI",
+		Cusip:              "922908769",
+		PayDate:            startOfTradeDate(parseDate("2024-03-27")),
+		Amount:             12_34,
+		DividendType:       QualifiedDividend,
+		ReinvestedQuantity: 54_321,
+		ReinvestPrice:      227_15,
+	}
+
+	// The reinvested shares open a long lot bought on the pay date under the dividend's activity id
+	lot := lotFromTransaction(reinvestment(dividend), LongPosition, 1)
+	if lot.AccountId != 7 || lot.ActivityId != 555 || lot.StockTicker != "VTI" || lot.Cusip != "922908769" ||
+		lot.OpenQuantity != 54_321 || lot.CostPerShare != 227_15 || !lot.AcquisitionDate.Equal(dividend.PayDate) {
+		t.Errorf("reinvested lot = %+v", lot)
+	}
+
+	// so they replace shares sold at a loss up to 30 days before the pay date
+	if !withinWashSaleWindow(startOfTradeDate(parseDate("2024-03-01")), lot.AcquisitionDate) {
+		t.Errorf("reinvestment on %s is not within 30 days of a sale on 2024-03-01", lot.AcquisitionDate)
+	}
+}
@@ -0,0 +1,42 @@
+package Matcher
+
+import (
+	"fmt"
+	"gains/Data"
+	"log/slog"
+)
+
+// RecordTransactionFee records a commission or regulatory fee against an activity that is already in
+// transaction_history. Fees of an activity that has not been matched are picked up when it is, an activity that was
+// already matched has its account recomputed so the fee reaches the lot basis or sale proceeds. The balance changes of
+// that recompute are returned.
+func RecordTransactionFee(db *Data.DatabaseHelper, fee Data.TransactionFee) ([]BalanceChange, error) {
+	switch fee.FeeType {
+	case "COMMISSION", "SEC_FEE", "TAF_FEE", "OPT_REG_FEE", "INDEX_OPTION_FEE", "OTHER":
+	default:
+		return nil, fmt.Errorf("unknown fee type %q", fee.FeeType)
+	}
+	if fee.Amount < 0 {
+		return nil, fmt.Errorf("invalid fee amount %d", fee.Amount)
+	}
+	exists, err := db.HasTransaction(fee.AccountId, fee.ActivityId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("activity %d is not in the transaction history of account %d", fee.ActivityId,
+			fee.AccountId)
+	}
+
+	if err := db.UpsertTransactionFee(fee); err != nil {
+		return nil, err
+	}
+	matched, err := db.HasMatchedTransaction(fee.AccountId, fee.ActivityId)
+	if err != nil || !matched {
+		return nil, err
+	}
+
+	slog.Info("Recomputing account for fee on matched activity", "accountId", fee.AccountId,
+		"activityId", fee.ActivityId, "feeType", fee.FeeType)
+	return RecomputeAccount(db, fee.AccountId)
+}
@@ -0,0 +1,52 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"time"
+)
+
+// HoldingTerm is whether a realized gain is taxed as short or long term
+type HoldingTerm string
+
+const (
+	ShortTerm HoldingTerm = "SHORT"
+	LongTerm  HoldingTerm = "LONG"
+	// Ordinary is used instead of a holding term for gains on positions marked to market, which are ordinary income
+	Ordinary HoldingTerm = "ORDINARY"
+)
+
+// ClassifyHoldingTerm applies the "more than one year" rule to the calendar dates of acquired and sold, so callers
+// with execution times pass their trade dates. The holding period starts the day after acquisition, so a sale on the
+// one year anniversary is still short term and the first long term day is the day after it. Shares bought on
+// February 29th use February 28th as their anniversary.
+func ClassifyHoldingTerm(acquired time.Time, sold time.Time) HoldingTerm {
+	year, month, day := acquired.Date()
+	if month == time.February && day == 29 {
+		day = 28
+	}
+	anniversary := time.Date(year+1, month, day, 0, 0, 0, 0, time.UTC)
+
+	soldYear, soldMonth, soldDay := sold.Date()
+	if time.Date(soldYear, soldMonth, soldDay, 0, 0, 0, 0, time.UTC).After(anniversary) {
+		return LongTerm
+	}
+	return ShortTerm
+}
+
+// TaxYear returns the tax year of a trade executed at t, the year of its trade date
+func TaxYear(t time.Time) int {
+	return dateOf(t).Year()
+}
+
+// dateOf returns the trade date of an execution time, its calendar date in US Eastern time, as midnight UTC so dates
+// compare and count whole days without daylight saving time getting in the way
+func dateOf(t time.Time) time.Time {
+	year, month, day := t.In(Data.EasternTime).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// startOfTradeDate returns the instant a trade date begins, midnight US Eastern time
+func startOfTradeDate(date time.Time) time.Time {
+	year, month, day := date.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, Data.EasternTime)
+}
@@ -0,0 +1,68 @@
+package Matcher
+
+import (
+	"testing"
+	"time"
+)
+
+// parseDate parses a YYYY-MM-DD trade date
+func parseDate(s string) time.Time {
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestClassifyHoldingTerm(t *testing.T) {
+	tests := []struct {
+		name     string
+		acquired string
+		sold     string
+		want     HoldingTerm
+	}{
+		{"same day", "2023-03-15", "2023-03-15", ShortTerm},
+		{"day before the anniversary", "2023-03-15", "2024-03-14", ShortTerm},
+		{"on the anniversary", "2023-03-15", "2024-03-15", ShortTerm},
+		{"day after the anniversary", "2023-03-15", "2024-03-16", LongTerm},
+		{"held over a leap day", "2023-12-01", "2024-12-01", ShortTerm},
+		{"held over a leap day, day after", "2023-12-01", "2024-12-02", LongTerm},
+		{"bought on a leap day, on February 28th", "2024-02-29", "2025-02-28", ShortTerm},
+		{"bought on a leap day, on March 1st", "2024-02-29", "2025-03-01", LongTerm},
+		{"bought February 28th of a leap year, on the anniversary", "2024-02-28", "2025-02-28", ShortTerm},
+		{"bought February 28th before a leap year, on the leap day", "2023-02-28", "2024-02-29", LongTerm},
+		{"bought March 1st before a leap year, on the anniversary", "2023-03-01", "2024-03-01", ShortTerm},
+		{"bought December 31st, sold January 1st two years on", "2022-12-31", "2024-01-01", LongTerm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyHoldingTerm(parseDate(tt.acquired), parseDate(tt.sold)); got != tt.want {
+				t.Errorf("ClassifyHoldingTerm(%s, %s) = %s, want %s", tt.acquired, tt.sold, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTradeDates(t *testing.T) {
+	tests := []struct {
+		name        string
+		executed    time.Time
+		wantDate    string
+		wantTaxYear int
+	}{
+		{"evening of December 31st in New York is already January 1st in UTC",
+			time.Date(2024, time.January, 1, 0, 30, 0, 0, time.UTC), "2023-12-31", 2023},
+		{"daylight saving time", time.Date(2024, time.July, 1, 3, 59, 0, 0, time.UTC), "2024-06-30", 2024},
+		{"after midnight in New York", time.Date(2024, time.July, 1, 4, 0, 0, 0, time.UTC), "2024-07-01", 2024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dateOf(tt.executed).Format(time.DateOnly); got != tt.wantDate {
+				t.Errorf("dateOf(%s) = %s, want %s", tt.executed, got, tt.wantDate)
+			}
+			if got := TaxYear(tt.executed); got != tt.wantTaxYear {
+				t.Errorf("TaxYear(%s) = %d, want %d", tt.executed, got, tt.wantTaxYear)
+			}
+		})
+	}
+}
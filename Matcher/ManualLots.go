@@ -0,0 +1,235 @@
+package Matcher
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"gains/Data"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// manualLotColumns is the header of a CSV of manually entered lots. The columns after basis_unknown are only needed
+// for gifted and inherited lots and may be left out.
+var manualLotColumns = []string{"ticker", "cusip", "quantity", "acquisition_date", "total_basis", "basis_unknown",
+	"acquisition_type", "donor_acquisition_date", "fair_market_value"}
+
+// requiredManualLotColumns is how many of manualLotColumns a CSV has to have
+const requiredManualLotColumns = 6
+
+// RecordManualLots records lots entered by hand, along with a TRANSFER_IN transaction for each that opens the lot
+// when the account is matched. All the lots are stored or none are. Sales already matched on or after a lot's
+// acquisition date found no shares to sell without it, so those accounts are recomputed and the rest just matched.
+func RecordManualLots(db *Data.DatabaseHelper, lots []Data.ManualLot) ([]Data.ManualLot, error) {
+	for i, lot := range lots {
+		if err := validateManualLot(lot); err != nil {
+			return nil, err
+		}
+		// An acquisition date given as a calendar date is acquired on that trade date
+		lots[i].AcquisitionDate = startOfTradeDate(lot.AcquisitionDate)
+		if !lot.DonorAcquisitionDate.IsZero() {
+			lots[i].DonorAcquisitionDate = startOfTradeDate(lot.DonorAcquisitionDate)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	recorded := make([]Data.ManualLot, 0, len(lots))
+	for _, lot := range lots {
+		lot, err := tx.InsertManualLot(lot)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.InsertManualTransaction(Data.TransactionData{
+			AccountId:    lot.AccountId,
+			ActivityId:   lot.ActivityId,
+			StockTicker:  lot.StockTicker,
+			Cusip:        lot.Cusip,
+			ShareCount:   lot.Quantity,
+			StockPrice:   lot.Quantity.PerShare(lot.TotalBasis),
+			OrderType:    "TRANSFER_IN",
+			ActivityDate: lot.AcquisitionDate,
+		})
+		if err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, lot)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing manual lots: %w", err)
+	}
+
+	stale := make(map[int]bool)
+	for _, lot := range recorded {
+		if stale[lot.AccountId] {
+			continue
+		}
+		matched, err := db.HasMatchedTransactionsAfter(lot.AccountId, lot.StockTicker, lot.AcquisitionDate)
+		if err != nil {
+			return nil, err
+		}
+		stale[lot.AccountId] = matched
+	}
+	for accountId, matched := range stale {
+		if matched {
+			slog.Info("Recomputing account for manually entered lots", "accountId", accountId)
+			if _, err := RecomputeAccount(db, accountId); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := MatchUnmatched(db, accountId); err != nil {
+			return nil, err
+		}
+	}
+	return recorded, nil
+}
+
+// validateManualLot checks that a manually entered lot says what was acquired, how much of it and when
+func validateManualLot(lot Data.ManualLot) error {
+	if lot.StockTicker == "" {
+		return errors.New("a manual lot needs a ticker")
+	}
+	if lot.Quantity <= 0 {
+		return fmt.Errorf("manual lot of %s needs a positive quantity", lot.StockTicker)
+	}
+	if lot.AcquisitionDate.IsZero() {
+		return fmt.Errorf("manual lot of %s needs an acquisition date", lot.StockTicker)
+	}
+	if lot.TotalBasis < 0 {
+		return fmt.Errorf("manual lot of %s has a negative basis", lot.StockTicker)
+	}
+	if lot.TotalBasis == 0 && !lot.BasisUnknown {
+		return fmt.Errorf("manual lot of %s needs a basis or to be marked basis unknown", lot.StockTicker)
+	}
+	if lot.AcquisitionType != "" && !ValidAcquisitionType(lot.AcquisitionType) {
+		return fmt.Errorf("manual lot of %s has unknown acquisition type %q", lot.StockTicker, lot.AcquisitionType)
+	}
+	if lot.AcquisitionType != GiftAcquisition && (!lot.DonorAcquisitionDate.IsZero() || lot.FairMarketValue != 0) {
+		return fmt.Errorf("manual lot of %s has a donor acquisition date or gift value but is not a gift",
+			lot.StockTicker)
+	}
+	if lot.FairMarketValue < 0 {
+		return fmt.Errorf("manual lot of %s has a negative fair market value", lot.StockTicker)
+	}
+	if lot.DonorAcquisitionDate.After(lot.AcquisitionDate) {
+		return fmt.Errorf("manual lot of %s was gifted before the donor acquired it", lot.StockTicker)
+	}
+	return nil
+}
+
+// ParseManualLotsCSV reads manually entered lots for an account from a CSV with the columns ticker, cusip, quantity,
+// acquisition_date, total_basis and basis_unknown, e.g. "VTI,922908769,12.5,2019-03-14,1843.75,false", optionally
+// followed by acquisition_type, donor_acquisition_date and fair_market_value for gifted and inherited lots. Amounts are
+// in dollars, and any column but ticker, quantity and acquisition_date may be left empty.
+func ParseManualLotsCSV(r io.Reader, accountId int) ([]Data.ManualLot, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading manual lot header: %w", err)
+	}
+	if len(header) < requiredManualLotColumns || len(header) > len(manualLotColumns) {
+		return nil, fmt.Errorf("manual lot CSV has %d columns, expected %d to %d", len(header),
+			requiredManualLotColumns, len(manualLotColumns))
+	}
+	for i, column := range header {
+		if !strings.EqualFold(strings.TrimSpace(column), manualLotColumns[i]) {
+			return nil, fmt.Errorf("manual lot column %d is %q, expected %q", i+1, column, manualLotColumns[i])
+		}
+	}
+	// Optional columns left out of the header read as empty
+	field := func(record []string, i int) string {
+		if i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var lots []Data.ManualLot
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading manual lots: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		lot := Data.ManualLot{
+			AccountId:   accountId,
+			StockTicker: strings.ToUpper(record[0]),
+			Cusip:       strings.ToUpper(record[1]),
+		}
+		if lot.Quantity, err = Data.ParseQuantity(record[2]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid quantity: %w", line, err)
+		}
+		if lot.AcquisitionDate, err = time.Parse(time.DateOnly, record[3]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid acquisition date: %w", line, err)
+		}
+		if lot.TotalBasis, err = parseCents(record[4]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid total basis: %w", line, err)
+		}
+		if record[5] != "" {
+			if lot.BasisUnknown, err = strconv.ParseBool(record[5]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid basis_unknown: %w", line, err)
+			}
+		}
+		lot.AcquisitionType = strings.ToUpper(field(record, 6))
+		if donorDate := field(record, 7); donorDate != "" {
+			if lot.DonorAcquisitionDate, err = time.Parse(time.DateOnly, donorDate); err != nil {
+				return nil, fmt.Errorf("line %d: invalid donor acquisition date: %w", line, err)
+			}
+		}
+		if lot.FairMarketValue, err = parseCents(field(record, 8)); err != nil {
+			return nil, fmt.Errorf("line %d: invalid fair market value: %w", line, err)
+		}
+		if err := validateManualLot(lot); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		lots = append(lots, lot)
+	}
+	return lots, nil
+}
+
+// parseCents parses a dollar amount such as "1843.75" into cents, treating an empty string as zero
+func parseCents(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	dollars, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(dollars * 100)), nil
+}
+
+// transferredLot builds the lot a TRANSFER_IN opens from the manual lot it was recorded for, carrying the full
+// entered basis and the original acquisition date. A gifted lot's holding period starts when the donor acquired it.
+func (m *matcher) transferredLot(transaction Data.TransactionData) (Data.TaxLot, bool) {
+	manual, ok := m.manualLots[transaction.ActivityId]
+	if !ok {
+		return Data.TaxLot{}, false
+	}
+	lot := lotFromTransaction(transaction, LongPosition, 1)
+	lot.BasisAdjustment = manual.TotalBasis - manual.Quantity.MulPrice(transaction.StockPrice)
+	lot.BasisUnknown = manual.BasisUnknown
+	lot.AcquisitionType = manual.AcquisitionType
+	if manual.AcquisitionType == GiftAcquisition {
+		lot.FairMarketValue = manual.Quantity.PerShare(manual.FairMarketValue)
+		if !manual.DonorAcquisitionDate.IsZero() {
+			lot.HoldingPeriodStart = manual.DonorAcquisitionDate
+		}
+	}
+	return lot, true
+}
@@ -0,0 +1,82 @@
+package Matcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseManualLotsCSV(t *testing.T) {
+	const header = "ticker,cusip,quantity,acquisition_date,total_basis,basis_unknown\n"
+	const giftHeader = "ticker,cusip,quantity,acquisition_date,total_basis,basis_unknown,acquisition_type," +
+		"donor_acquisition_date,fair_market_value\n"
+
+	lots, err := ParseManualLotsCSV(strings.NewReader(header+
+		"vti,922908769,12.5,2019-03-14,1843.75,false\n"+
+		"AAPL,,3,2015-06-01,,true\n"), 12345678)
+	if err != nil {
+		t.Fatalf("ParseManualLotsCSV() error = %v", err)
+	}
+	if len(lots) != 2 {
+		t.Fatalf("ParseManualLotsCSV() returned %d lots, want 2", len(lots))
+	}
+	if lot := lots[0]; lot.AccountId != 12345678 || lot.StockTicker != "VTI" || lot.Quantity.String() != "12.5" ||
+		lot.TotalBasis != 1_843_75 || lot.BasisUnknown || !lot.AcquisitionDate.Equal(parseDate("2019-03-14")) {
+		t.Errorf("first lot = %+v", lot)
+	}
+	if lot := lots[1]; lot.TotalBasis != 0 || !lot.BasisUnknown || lot.Cusip != "" {
+		t.Errorf("second lot = %+v", lot)
+	}
+
+	lots, err = ParseManualLotsCSV(strings.NewReader(giftHeader+
+		"VTI,,10,2024-01-10,1000,false,gift,2020-03-01,600\n"), 12345678)
+	if err != nil {
+		t.Fatalf("ParseManualLotsCSV() error = %v", err)
+	}
+	if lot := lots[0]; lot.AcquisitionType != GiftAcquisition || lot.FairMarketValue != 600_00 ||
+		!lot.DonorAcquisitionDate.Equal(parseDate("2020-03-01")) {
+		t.Errorf("gifted lot = %+v", lot)
+	}
+
+	tests := []struct {
+		name    string
+		csv     string
+		wantErr string
+	}{
+		{"empty file", "", "error reading manual lot header"},
+		{"too few columns", "ticker,cusip,quantity\n", "expected 6 to 9"},
+		{"misnamed column", "ticker,cusip,shares,acquisition_date,total_basis,basis_unknown\n",
+			`column 3 is "shares"`},
+		{"wrong number of fields", header + "VTI,,1,2019-03-14,100\n", "error reading manual lots"},
+		{"invalid quantity", header + "VTI,,1.2345678,2019-03-14,100,false\n", "line 2: invalid quantity"},
+		{"invalid date", header + "VTI,,1,03/14/2019,100,false\n", "line 2: invalid acquisition date"},
+		{"invalid basis", header + "VTI,,1,2019-03-14,$100,false\n", "line 2: invalid total basis"},
+		{"invalid basis_unknown", header + "VTI,,1,2019-03-14,100,maybe\n", "line 2: invalid basis_unknown"},
+		{"missing ticker", header + ",,1,2019-03-14,100,false\n", "line 2: a manual lot needs a ticker"},
+		{"zero quantity", header + "VTI,,0,2019-03-14,100,false\n", "line 2: manual lot of VTI needs a positive"},
+		{"negative basis", header + "VTI,,1,2019-03-14,-100,false\n", "line 2: manual lot of VTI has a negative"},
+		{"no basis", header + "VTI,,1,2019-03-14,,false\n", "line 2: manual lot of VTI needs a basis"},
+		{"error on a later row", header + "VTI,,1,2019-03-14,100,false\nVTI,,x,2019-03-14,100,false\n",
+			"line 3: invalid quantity"},
+		{"unknown acquisition type", giftHeader + "VTI,,1,2019-03-14,100,false,STOLEN,,\n",
+			`unknown acquisition type "STOLEN"`},
+		{"gift value on a purchase", giftHeader + "VTI,,1,2019-03-14,100,false,PURCHASE,,50\n",
+			"is not a gift"},
+		{"invalid donor date", giftHeader + "VTI,,1,2019-03-14,100,false,GIFT,2019-02-30,50\n",
+			"line 2: invalid donor acquisition date"},
+		{"gifted before the donor acquired it", giftHeader + "VTI,,1,2019-03-14,100,false,GIFT,2020-01-01,50\n",
+			"gifted before the donor acquired it"},
+		{"invalid fair market value", giftHeader + "VTI,,1,2019-03-14,100,false,GIFT,2018-01-01,n/a\n",
+			"line 2: invalid fair market value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lots, err := ParseManualLotsCSV(strings.NewReader(tt.csv), 12345678)
+			if err == nil {
+				t.Fatalf("ParseManualLotsCSV() = %+v, want an error containing %q", lots, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseManualLotsCSV() error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"log"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// deemedSale is the order type of the year-end sale of a position marked to market
+const deemedSale = "DEEMED_SALE"
+
+// markToMarket reports whether a trade executed at t falls in a tax year covered by the account's Section 475(f)
+// election
+func (m *matcher) markToMarket(t time.Time) bool {
+	return m.markToMarketFrom != 0 && TaxYear(t) >= m.markToMarketFrom
+}
+
+// markYearEnds books the year-end deemed sales of every tax year covered by the election before through that have not
+// been booked yet, applying the corporate actions effective in each year first
+func (m *matcher) markYearEnds(through int) error {
+	if m.markToMarketFrom == 0 {
+		return nil
+	}
+	for taxYear := m.markToMarketFrom; taxYear < through; taxYear++ {
+		if m.markedYears[taxYear] {
+			continue
+		}
+		if err := m.applyCorporateActionsThrough(time.Date(taxYear, time.December, 31, 0, 0, 0, 0, time.UTC)); err != nil {
+			return err
+		}
+		if err := m.markYearEnd(taxYear); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markYearEnd treats every open position as sold at the last close of the tax year and bought back at the same
+// price. The sale books an ordinary gain or loss through the usual ledger, and each closed lot is replaced by a child
+// lot with the closing price as its basis and a holding period starting at the close. Positions without a recorded
+// closing price are left open and logged, record the price and recompute the account to mark them.
+func (m *matcher) markYearEnd(taxYear int) error {
+	yearEnd := time.Date(taxYear, time.December, 31, 16, 0, 0, 0, Data.EasternTime)
+	for _, side := range []PositionSide{LongPosition, ShortPosition} {
+		tickers := make([]string, 0, len(m.lots[side]))
+		for ticker := range m.lots[side] {
+			tickers = append(tickers, ticker)
+		}
+		sort.Strings(tickers)
+
+		for _, ticker := range tickers {
+			open, shares := markedLots(m.lots[side][ticker], yearEnd)
+			if shares == 0 {
+				continue
+			}
+
+			closePrice, _, ok, err := m.db.GetClosingPrice(ticker, yearEnd)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				slog.Warn("No year-end closing price to mark position to market", "ticker", ticker,
+					"taxYear", taxYear, "shares", shares)
+				continue
+			}
+
+			err = m.closeLots(Data.TransactionData{
+				AccountId:    m.accountId,
+				StockTicker:  ticker,
+				Cusip:        open[0].lot.Cusip,
+				ShareCount:   shares,
+				StockPrice:   closePrice,
+				OrderType:    deemedSale,
+				ActivityDate: yearEnd,
+			}, side, 0, 0)
+			if err != nil {
+				return err
+			}
+
+			for _, o := range open {
+				inserted, err := m.db.InsertTaxLot(repurchasedLot(o, closePrice, yearEnd))
+				if err != nil {
+					return err
+				}
+				m.addLots(&inserted)
+			}
+		}
+	}
+
+	if err := m.db.MarkYearMarkedToMarket(m.accountId, taxYear); err != nil {
+		return err
+	}
+	m.markedYears[taxYear] = true
+	log.Printf("Marked open positions to market at the %d year-end close", taxYear)
+	return nil
+}
+
+// markedLot is a lot marked to market with the open quantity it held at the year-end close
+type markedLot struct {
+	lot      *Data.TaxLot
+	quantity Data.Quantity
+}
+
+// markedLots returns the lots of a position still open at the year-end close and the shares they hold together
+func markedLots(lots []*Data.TaxLot, yearEnd time.Time) ([]markedLot, Data.Quantity) {
+	var open []markedLot
+	var shares Data.Quantity
+	for _, lot := range lots {
+		if lot.OpenQuantity > 0 && lot.AcquisitionDate.Before(yearEnd) {
+			open = append(open, markedLot{lot: lot, quantity: lot.OpenQuantity})
+			shares += lot.OpenQuantity
+		}
+	}
+	return open, shares
+}
+
+// repurchasedLot is the child lot that buys back the shares of a lot deemed sold at the year-end close. It starts
+// over at the closing price as a plain purchase, without the adjustments, holding period or gift basis of the lot.
+func repurchasedLot(marked markedLot, closePrice int64, yearEnd time.Time) Data.TaxLot {
+	repurchased := *marked.lot
+	repurchased.LotId = 0
+	repurchased.ParentLotId = marked.lot.LotId
+	repurchased.OriginalQuantity = marked.quantity
+	repurchased.OpenQuantity = marked.quantity
+	repurchased.CostPerShare = closePrice
+	repurchased.BasisAdjustment = 0
+	repurchased.AcquisitionDate = yearEnd
+	repurchased.HoldingPeriodStart = yearEnd
+	repurchased.WashSaleReplacement = false
+	repurchased.BasisUnknown = false
+	repurchased.AcquisitionType = PurchaseAcquisition
+	repurchased.FairMarketValue = 0
+	return repurchased
+}
@@ -0,0 +1,95 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarkToMarket(t *testing.T) {
+	tests := []struct {
+		name             string
+		markToMarketFrom int
+		executed         time.Time
+		want             bool
+	}{
+		{"no election", 0, parseDate("2024-06-03"), false},
+		{"year before the election", 2024, startOfTradeDate(parseDate("2023-12-29")), false},
+		{"first year of the election", 2024, startOfTradeDate(parseDate("2024-01-02")), true},
+		{"later year", 2024, startOfTradeDate(parseDate("2026-03-02")), true},
+		{"evening of December 31st counts in its Eastern tax year", 2024,
+			time.Date(2024, time.January, 1, 1, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &matcher{markToMarketFrom: tt.markToMarketFrom}
+			if got := m.markToMarket(tt.executed); got != tt.want {
+				t.Errorf("markToMarket(%s) from %d = %v, want %v", tt.executed, tt.markToMarketFrom, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkedLots(t *testing.T) {
+	yearEnd := time.Date(2024, time.December, 31, 16, 0, 0, 0, Data.EasternTime)
+	closed := testLot(2, 102, "2024-03-10", 10, 90_00)
+	closed.OpenQuantity = 0
+	lateFill := testLot(4, 104, "2024-12-31", 4, 95_00)
+	lateFill.AcquisitionDate = yearEnd.Add(time.Minute)
+	lots := []*Data.TaxLot{
+		testLot(1, 101, "2024-01-10", 10, 100_00),
+		closed,
+		testLot(3, 103, "2024-12-31", 2_500_000, 110_00),
+		lateFill,
+		testLot(5, 105, "2025-01-02", 1, 120_00),
+	}
+	lots[2].OpenQuantity = 2_500_000
+
+	open, shares := markedLots(lots, yearEnd)
+	var ids []int64
+	for _, o := range open {
+		ids = append(ids, o.lot.LotId)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 3}) || shares != 12_500_000 {
+		t.Errorf("markedLots() = lots %v holding %s shares, want [1 3] holding 12.5", ids, shares)
+	}
+	if open[1].quantity != 2_500_000 {
+		t.Errorf("lot 3 marked with %s shares, want 2.5", open[1].quantity)
+	}
+}
+
+func TestRepurchasedLot(t *testing.T) {
+	yearEnd := time.Date(2024, time.December, 31, 16, 0, 0, 0, Data.EasternTime)
+	lot := testLot(9, 109, "2024-01-10", 10, 100_00)
+	lot.OpenQuantity = Data.Shares(4)
+	lot.BasisAdjustment = 25_00
+	lot.HoldingPeriodStart = parseDate("2023-11-01")
+	lot.WashSaleReplacement = true
+	lot.BasisUnknown = true
+	lot.AcquisitionType = GiftAcquisition
+	lot.FairMarketValue = 80_00
+	lot.Cusip = "922908769"
+
+	got := repurchasedLot(markedLot{lot: lot, quantity: lot.OpenQuantity}, 130_00, yearEnd)
+	want := Data.TaxLot{
+		ActivityId:         109,
+		StockTicker:        "VTI",
+		Cusip:              "922908769",
+		ParentLotId:        9,
+		OriginalQuantity:   Data.Shares(4),
+		OpenQuantity:       Data.Shares(4),
+		CostPerShare:       130_00,
+		AcquisitionDate:    yearEnd,
+		HoldingPeriodStart: yearEnd,
+		PositionSide:       string(LongPosition),
+		Multiplier:         1,
+		AcquisitionType:    PurchaseAcquisition,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("repurchasedLot() =\n%+v\nwant\n%+v", got, want)
+	}
+	if lot.LotId != 9 || lot.BasisAdjustment != 25_00 {
+		t.Errorf("repurchasedLot() changed the marked lot to %+v", *lot)
+	}
+}
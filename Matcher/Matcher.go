@@ -0,0 +1,410 @@
+package Matcher
+
+import (
+	"fmt"
+	"gains/Data"
+	"log"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// PositionSide is whether a lot holds purchased shares or shares sold short
+type PositionSide string
+
+const (
+	LongPosition  PositionSide = "LONG"
+	ShortPosition PositionSide = "SHORT"
+)
+
+// matcher holds the state of a single MatchOrders run
+type matcher struct {
+	db                 *Data.DatabaseHelper
+	accountId          int
+	accountMethod      CostBasisMethod
+	overrides          map[int64]string
+	elections          map[string]map[string]CostBasisMethod
+	manualLots         map[int64]Data.ManualLot
+	actions            []Data.CorporateAction
+	markToMarketFrom   int
+	markedYears        map[int]bool
+	lots               map[PositionSide]map[string][]*Data.TaxLot
+	changes            map[int]*termChange
+	matchedActivityIds []int64
+}
+
+// termChange is the short and long term capital gains and the ordinary mark-to-market gains a run realized in one tax
+// year
+type termChange struct {
+	shortTerm int64
+	longTerm  int64
+	ordinary  int64
+}
+
+// MatchOrders takes in a list of unmatched transactions, opens a tax lot for every buy and matches any sells against
+// the open lots for that ticker (partial or fully) using the cost basis method elected for the security, its asset
+// type or the account, or the sale's override if one was recorded. Short sales open short lots the same way and are
+// closed by buys to cover, and options are handled as lots of contracts keyed by their OCC symbol. Each match is
+// classified as short or long term from the lot's holding period, and losses with replacement shares bought within
+// 30 days before or after the sale are deferred under the wash sale rule. Remaining lot quantities are persisted so a
+// partially sold lot is picked up where it left off on the next run, and every match is recorded in the realized
+// gains ledger along with the method that chose it, so the yearly balance can be traced back to individual
+// executions. Gains count toward the tax year of the sale's trade date and the net change of every tax year the batch
+// touched is returned. Accounts with a mark-to-market election book ordinary gains without wash sales instead, and
+// have their open positions deemed sold and bought back at every year-end close. An error leaves the run half done,
+// so callers that need the writes to stand together pass a database transaction and roll it back.
+func MatchOrders(transactions []Data.TransactionData, db *Data.DatabaseHelper) (map[int]int64, error) {
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+	return matchAccount(db, transactions[0].AccountId, transactions)
+}
+
+// matchAccount runs the matcher over an account's transactions, applying any pending corporate actions to its lots
+// in date order along the way
+func matchAccount(db *Data.DatabaseHelper, accountId int, transactions []Data.TransactionData) (map[int]int64,
+	error) {
+	m := &matcher{
+		db:        db,
+		accountId: accountId,
+		changes:   make(map[int]*termChange),
+		lots: map[PositionSide]map[string][]*Data.TaxLot{
+			LongPosition:  make(map[string][]*Data.TaxLot),
+			ShortPosition: make(map[string][]*Data.TaxLot),
+		},
+	}
+
+	openLots, err := db.GetOpenTaxLotsByAccountID(accountId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range openLots {
+		m.addLots(&openLots[i])
+	}
+
+	accountMethod, err := db.GetCostBasisMethod(accountId)
+	if err != nil {
+		return nil, err
+	}
+	m.accountMethod = ParseCostBasisMethod(accountMethod)
+	m.overrides, err = db.GetSaleCostBasisOverrides(accountId)
+	if err != nil {
+		return nil, err
+	}
+	elections, err := db.GetCostBasisElections(accountId)
+	if err != nil {
+		return nil, err
+	}
+	m.elections = map[string]map[string]CostBasisMethod{
+		SecurityScope:  make(map[string]CostBasisMethod),
+		AssetTypeScope: make(map[string]CostBasisMethod),
+	}
+	for _, election := range elections {
+		if _, ok := m.elections[election.Scope]; ok {
+			m.elections[election.Scope][election.ScopeValue] = ParseCostBasisMethod(election.CostBasisMethod)
+		}
+	}
+
+	m.manualLots, err = db.GetManualLotsByAccountID(accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	m.actions, err = db.GetPendingCorporateActions(accountId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	m.markToMarketFrom, err = db.GetMarkToMarketFrom(accountId)
+	if err != nil {
+		return nil, err
+	}
+	m.markedYears, err = db.GetMarkedToMarketYears(accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].ActivityDate.Before(transactions[j].ActivityDate)
+	})
+
+	for _, transaction := range transactions {
+		if transaction.Matched == true {
+			continue
+		}
+		if err := m.markYearEnds(TaxYear(transaction.ActivityDate)); err != nil {
+			return nil, err
+		}
+		if err := m.applyCorporateActionsThrough(dateOf(transaction.ActivityDate)); err != nil {
+			return nil, err
+		}
+		if err := m.match(transaction); err != nil {
+			return nil, fmt.Errorf("error matching activity %d: %w", transaction.ActivityId, err)
+		}
+	}
+	if err := m.markYearEnds(TaxYear(time.Now())); err != nil {
+		return nil, err
+	}
+	for _, action := range m.actions {
+		if err := m.applyCorporateAction(action); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := db.MatchTransactions(accountId, m.matchedActivityIds); err != nil {
+		return nil, err
+	}
+	netChanges := make(map[int]int64)
+	for taxYear, change := range m.changes {
+		if err := db.UpsertCapitalGainsBalance(accountId, taxYear, change.shortTerm, change.longTerm, 0); err != nil {
+			return nil, err
+		}
+		netChanges[taxYear] = change.shortTerm + change.longTerm
+		if change.ordinary != 0 {
+			if err := db.AddOrdinaryGain(accountId, taxYear, change.ordinary); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if _, err := ComputeCapitalLossCarryovers(db, accountId); err != nil {
+		return nil, err
+	}
+	return netChanges, nil
+}
+
+// match opens or closes lots for a single transaction according to its order type
+func (m *matcher) match(transaction Data.TransactionData) error {
+	switch transaction.OrderType {
+	case "BUY", "REINVEST":
+		return m.openLot(lotFromTransaction(transaction, LongPosition, 1))
+	case "TRANSFER_IN":
+		lot, ok := m.transferredLot(transaction)
+		if !ok {
+			slog.Warn("Transfer has no manual lot", "activityId", transaction.ActivityId)
+			return nil
+		}
+		return m.openLot(lot)
+	case "SELL_SHORT":
+		return m.openLot(lotFromTransaction(transaction, ShortPosition, 1))
+	case "SELL":
+		return m.closeLots(transaction, LongPosition, 0, 0)
+	case "BUY_TO_COVER":
+		return m.closeLots(transaction, ShortPosition, 0, 0)
+	case "BUY_TO_OPEN":
+		return m.openLot(lotFromTransaction(transaction, LongPosition, contractMultiplier))
+	case "SELL_TO_OPEN":
+		return m.openLot(lotFromTransaction(transaction, ShortPosition, contractMultiplier))
+	case "SELL_TO_CLOSE":
+		return m.closeLots(transaction, LongPosition, 0, 0)
+	case "BUY_TO_CLOSE":
+		return m.closeLots(transaction, ShortPosition, 0, 0)
+	case "EXPIRATION":
+		return m.expireOption(transaction)
+	case "EXERCISE":
+		return m.exerciseOption(transaction, LongPosition)
+	case "ASSIGNMENT":
+		return m.exerciseOption(transaction, ShortPosition)
+	}
+	return nil
+}
+
+// addLots makes lots available to be matched by later transactions in the run
+func (m *matcher) addLots(lots ...*Data.TaxLot) {
+	for _, lot := range lots {
+		side := PositionSide(lot.PositionSide)
+		m.lots[side][lot.StockTicker] = append(m.lots[side][lot.StockTicker], lot)
+	}
+}
+
+// lotFromTransaction builds the lot an opening transaction creates. Fees paid to open the position are added to the
+// lot's basis, which for a short lot has the same effect as taking them off the short sale proceeds.
+func lotFromTransaction(transaction Data.TransactionData, side PositionSide, multiplier int) Data.TaxLot {
+	return Data.TaxLot{
+		AccountId:        transaction.AccountId,
+		ActivityId:       transaction.ActivityId,
+		LegId:            transaction.LegId,
+		StockTicker:      transaction.StockTicker,
+		OriginalQuantity: transaction.ShareCount,
+		OpenQuantity:     transaction.ShareCount,
+		CostPerShare:     transaction.StockPrice,
+		AcquisitionDate:  transaction.ActivityDate,
+		PositionSide:     string(side),
+		Multiplier:       multiplier,
+		BasisAdjustment:  transaction.Fees,
+		Cusip:            transaction.Cusip,
+	}
+}
+
+// openLot persists a lot opened by a BUY, SELL_SHORT or option opening transaction without adjusting gains
+func (m *matcher) openLot(newLot Data.TaxLot) error {
+	ticker := newLot.StockTicker
+	lot, err := m.db.InsertTaxLot(newLot)
+	if err != nil {
+		return err
+	}
+	m.addLots(&lot)
+
+	if m.replacesPriorLosses(&lot) {
+		// Losses already booked within 30 days of this purchase become wash sales
+		disallowedLoss, splitLots, err := washSaleAtPurchase(m.db, &lot)
+		if err != nil {
+			return err
+		}
+		m.addLots(splitLots...)
+		if disallowedLoss != 0 {
+			log.Printf("Disallowed $%.2f of prior losses on %s as wash sales", float64(disallowedLoss)/100, ticker)
+		}
+	}
+	m.matchedActivityIds = append(m.matchedActivityIds, lot.ActivityId)
+	return nil
+}
+
+// replacesPriorLosses reports whether opening the lot can wash losses realized before it. Only purchased long shares
+// are replacement shares, and an account marked to market has no wash sales.
+func (m *matcher) replacesPriorLosses(lot *Data.TaxLot) bool {
+	return PositionSide(lot.PositionSide) == LongPosition && purchased(lot) && !m.markToMarket(lot.AcquisitionDate)
+}
+
+// closeLots matches a SELL against long lots or a BUY_TO_COVER against short lots and books the realized gains. The
+// gain on a short position is the short sale price less the cover price and is always short term, since the shares
+// delivered to close it are bought on the cover date. Fees of the closing transaction come off the proceeds of a sale
+// and are added to the cost of a cover. proceedsAdjustment is spread over the matched shares, e.g. the premium of an
+// option whose exercise caused the sale, and corporateActionId is recorded on the ledger rows of a sale forced by a
+// corporate action.
+func (m *matcher) closeLots(transaction Data.TransactionData, side PositionSide, proceedsAdjustment int64,
+	corporateActionId int64) error {
+	ticker := transaction.StockTicker
+	method := m.methodFor(transaction)
+	var selections []Data.LotSelection
+	if method == SpecificId {
+		var err error
+		selections, err = m.db.GetSpecificLotSelections(m.accountId, transaction.ActivityId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if method == AverageCost && side == LongPosition {
+		for _, lot := range averageLots(m.lots[side][ticker], transaction.ActivityDate) {
+			if err := m.db.UpdateTaxLot(*lot); err != nil {
+				return err
+			}
+		}
+	}
+
+	allocations, unmatchedShares := allocateLots(transaction, m.lots[side][ticker], method, selections)
+	var allocated Data.Quantity
+	for _, allocation := range allocations {
+		shares := allocation.quantity * Data.Quantity(allocation.lot.Multiplier)
+		closePrice := shares.MulPrice(transaction.StockPrice)
+		openPrice := shares.MulPrice(allocation.lot.CostPerShare)
+		adjustment := prorate(proceedsAdjustment, transaction.ShareCount, allocated, allocation.quantity)
+		fees := prorate(transaction.Fees, transaction.ShareCount, allocated, allocation.quantity)
+		allocated += allocation.quantity
+		proceeds, costBasis := closePrice+adjustment-fees, openPrice+allocation.basisAdjustment
+		term := lotHoldingTerm(allocation.lot, dateOf(transaction.ActivityDate))
+		if side == ShortPosition {
+			proceeds, costBasis = openPrice+adjustment, closePrice+allocation.basisAdjustment+fees
+			term = ShortTerm
+		} else {
+			costBasis, term = giftedBasis(allocation.lot, shares, costBasis, proceeds, dateOf(transaction.ActivityDate),
+				term)
+		}
+		if m.markToMarket(transaction.ActivityDate) {
+			term = Ordinary
+		}
+		gain := proceeds - costBasis
+		if err := m.db.UpdateTaxLot(*allocation.lot); err != nil {
+			return err
+		}
+
+		var disallowedLoss int64
+		var washSaleQuantity Data.Quantity
+		if gain < 0 && side == LongPosition && term != Ordinary {
+			var splitLots []*Data.TaxLot
+			var err error
+			disallowedLoss, washSaleQuantity, splitLots, err = washSaleAtSale(m.db, transaction, allocation, gain,
+				m.lots[side][ticker])
+			if err != nil {
+				return err
+			}
+			m.addLots(splitLots...)
+		}
+
+		err := m.db.InsertRealizedGain(Data.RealizedGain{
+			AccountId:         m.accountId,
+			SellActivityId:    transaction.ActivityId,
+			LotId:             allocation.lot.LotId,
+			StockTicker:       ticker,
+			SellDate:          transaction.ActivityDate,
+			Quantity:          allocation.quantity,
+			Proceeds:          proceeds,
+			CostBasis:         costBasis,
+			Gain:              gain,
+			CostBasisMethod:   string(method),
+			HoldingTerm:       string(term),
+			BasisAdjustment:   allocation.basisAdjustment,
+			DisallowedLoss:    disallowedLoss,
+			WashSaleQuantity:  washSaleQuantity,
+			CorporateActionId: corporateActionId,
+			BasisUnknown:      allocation.lot.BasisUnknown,
+			DeemedSale:        transaction.OrderType == deemedSale,
+		})
+		if err != nil {
+			return err
+		}
+		// Only the allowed part of a loss is recognized, the rest lives on in the replacement shares
+		m.recognize(term, gain+disallowedLoss, transaction.ActivityDate)
+		capitalGainsBalance := float64(gain+disallowedLoss) / 100
+		log.Printf("Found new %s term capital gain/loss for stock ticker: %s for $%.2f using %s", term,
+			ticker, capitalGainsBalance, method)
+		log.Println()
+	}
+	if unmatchedShares > 0 {
+		slog.Warn("Closing transaction has no open lots for remaining shares", "ticker", ticker,
+			"activityId", transaction.ActivityId, "side", side, "shares", unmatchedShares)
+	}
+	m.matchedActivityIds = append(m.matchedActivityIds, transaction.ActivityId)
+	return nil
+}
+
+// methodFor returns the cost basis method a closing transaction is matched with: the sale's own override, else the
+// method elected for its security by ticker or CUSIP, else the one elected for its asset type, else the account's
+func (m *matcher) methodFor(transaction Data.TransactionData) CostBasisMethod {
+	if override, ok := m.overrides[transaction.ActivityId]; ok {
+		return ParseCostBasisMethod(override)
+	}
+	if method, ok := m.elections[SecurityScope][transaction.StockTicker]; ok {
+		return method
+	}
+	if method, ok := m.elections[SecurityScope][transaction.Cusip]; ok && transaction.Cusip != "" {
+		return method
+	}
+	if method, ok := m.elections[AssetTypeScope][transaction.AssetType]; ok && transaction.AssetType != "" {
+		return method
+	}
+	return m.accountMethod
+}
+
+// recognize adds a realized gain or loss to the run's total for its holding term in the tax year of the sale
+func (m *matcher) recognize(term HoldingTerm, gain int64, sold time.Time) {
+	taxYear := TaxYear(sold)
+	change, ok := m.changes[taxYear]
+	if !ok {
+		change = &termChange{}
+		m.changes[taxYear] = change
+	}
+	switch term {
+	case LongTerm:
+		change.longTerm += gain
+	case Ordinary:
+		change.ordinary += gain
+	default:
+		change.shortTerm += gain
+	}
+}
+
+// prorate returns the share of amount belonging to quantity out of total after before was already given its share.
+// Working from the running total keeps the shares summing to amount once the whole total is accounted for.
+func prorate(amount int64, total Data.Quantity, before Data.Quantity, quantity Data.Quantity) int64 {
+	return (before+quantity).Portion(amount, total) - before.Portion(amount, total)
+}
@@ -0,0 +1,162 @@
+package Matcher
+
+import (
+	"fmt"
+	"gains/Data"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// contractMultiplier is the number of shares of the underlying a standard equity option contract covers
+const contractMultiplier = 100
+
+// OptionContract is the contract described by an OCC option symbol
+type OptionContract struct {
+	Underlying string
+	Expiration time.Time
+	// PutCall is "C" for calls and "P" for puts
+	PutCall string
+	// Strike is the strike price in cents
+	Strike int64
+}
+
+// ParseOptionSymbol parses an OCC symbol such as "AAPL  240119C00190000": the underlying root padded to six
+// characters, the expiration as YYMMDD, C or P, and the strike price times 1000 padded to eight digits
+func ParseOptionSymbol(symbol string) (OptionContract, error) {
+	if len(symbol) < 16 {
+		return OptionContract{}, fmt.Errorf("invalid option symbol %q", symbol)
+	}
+	suffix := symbol[len(symbol)-15:]
+
+	expiration, err := time.Parse("060102", suffix[:6])
+	if err != nil {
+		return OptionContract{}, fmt.Errorf("invalid expiration in option symbol %q: %w", symbol, err)
+	}
+	putCall := suffix[6:7]
+	if putCall != "C" && putCall != "P" {
+		return OptionContract{}, fmt.Errorf("invalid put/call flag in option symbol %q", symbol)
+	}
+	strike, err := strconv.ParseInt(suffix[7:], 10, 64)
+	if err != nil {
+		return OptionContract{}, fmt.Errorf("invalid strike in option symbol %q: %w", symbol, err)
+	}
+	if strike < 0 {
+		return OptionContract{}, fmt.Errorf("invalid strike in option symbol %q", symbol)
+	}
+
+	return OptionContract{
+		Underlying: strings.TrimSpace(symbol[:len(symbol)-15]),
+		Expiration: expiration,
+		PutCall:    putCall,
+		Strike:     strike / 10,
+	}, nil
+}
+
+// RecordOptionEvent records an option expiring worthless (EXPIRATION), a long option being exercised (EXERCISE) or a
+// short option being assigned (ASSIGNMENT) for the given number of contracts and matches it right away
+func RecordOptionEvent(db *Data.DatabaseHelper, accountId int, symbol string, eventType string,
+	contracts Data.Quantity, date time.Time) error {
+	return recordOptionEvent(db, accountId, 0, symbol, eventType, contracts, date)
+}
+
+// recordOptionEvent records an option event under the given activity id, or a new manual one when it is 0
+func recordOptionEvent(db *Data.DatabaseHelper, accountId int, activityId int64, symbol string, eventType string,
+	contracts Data.Quantity, date time.Time) error {
+	if eventType != "EXPIRATION" && eventType != "EXERCISE" && eventType != "ASSIGNMENT" {
+		return fmt.Errorf("unknown option event %q", eventType)
+	}
+	if _, err := ParseOptionSymbol(symbol); err != nil {
+		return err
+	}
+
+	_, err := db.InsertManualTransaction(Data.TransactionData{
+		AccountId:    accountId,
+		ActivityId:   activityId,
+		StockTicker:  symbol,
+		ShareCount:   contracts,
+		OrderType:    eventType,
+		ActivityDate: date,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = MatchUnmatched(db, accountId)
+	return err
+}
+
+// expireOption closes the open contracts of an option that expired worthless at a price of zero. A long option
+// realizes the premium paid as a loss and a short option the premium received as a gain.
+func (m *matcher) expireOption(transaction Data.TransactionData) error {
+	side := ShortPosition
+	for _, lot := range m.lots[LongPosition][transaction.StockTicker] {
+		if lot.OpenQuantity > 0 {
+			side = LongPosition
+		}
+	}
+	transaction.StockPrice = 0
+	return m.closeLots(transaction, side, 0, 0)
+}
+
+// exerciseOption closes contracts of a long option that was exercised or a short option that was assigned and folds
+// their premium into the resulting stock trade at the strike price. Buying shares through a call exercise or put
+// assignment adds the premium paid or subtracts the premium received from the new lot's basis, and selling shares
+// through a put exercise or call assignment subtracts the premium paid or adds the premium received to the proceeds.
+// No gain is realized on the option itself.
+func (m *matcher) exerciseOption(transaction Data.TransactionData, side PositionSide) error {
+	contract, err := ParseOptionSymbol(transaction.StockTicker)
+	if err != nil {
+		return err
+	}
+
+	allocations, unmatchedContracts := allocateLots(transaction, m.lots[side][transaction.StockTicker], FIFO, nil)
+	var premium int64
+	for _, allocation := range allocations {
+		shares := allocation.quantity * Data.Quantity(allocation.lot.Multiplier)
+		premium += shares.MulPrice(allocation.lot.CostPerShare) + allocation.basisAdjustment
+		if err := m.db.UpdateTaxLot(*allocation.lot); err != nil {
+			return err
+		}
+	}
+	if unmatchedContracts > 0 {
+		slog.Warn("Option event has no open lots for remaining contracts", "symbol", transaction.StockTicker,
+			"activityId", transaction.ActivityId, "side", side, "contracts", unmatchedContracts)
+	}
+	m.matchedActivityIds = append(m.matchedActivityIds, transaction.ActivityId)
+
+	contracts := transaction.ShareCount - unmatchedContracts
+	if contracts == 0 {
+		return nil
+	}
+	stockTrade := Data.TransactionData{
+		AccountId:    transaction.AccountId,
+		ActivityId:   transaction.ActivityId,
+		StockTicker:  contract.Underlying,
+		ShareCount:   contracts * contractMultiplier,
+		StockPrice:   contract.Strike,
+		ActivityDate: transaction.ActivityDate,
+		Fees:         transaction.Fees,
+	}
+	log.Printf("Option %s %s for %s contract(s), folding $%.2f of premium into the %s trade",
+		transaction.StockTicker, strings.ToLower(transaction.OrderType), contracts, float64(premium)/100,
+		contract.Underlying)
+
+	switch {
+	case side == LongPosition && contract.PutCall == "C":
+		lot := lotFromTransaction(stockTrade, LongPosition, 1)
+		lot.BasisAdjustment += premium
+		return m.openLot(lot)
+	case side == ShortPosition && contract.PutCall == "P":
+		lot := lotFromTransaction(stockTrade, LongPosition, 1)
+		lot.BasisAdjustment -= premium
+		return m.openLot(lot)
+	case side == LongPosition && contract.PutCall == "P":
+		return m.closeLots(stockTrade, LongPosition, -premium, 0)
+	case side == ShortPosition && contract.PutCall == "C":
+		return m.closeLots(stockTrade, LongPosition, premium, 0)
+	}
+	return nil
+}
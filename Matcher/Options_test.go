@@ -0,0 +1,50 @@
+package Matcher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseOptionSymbol(t *testing.T) {
+	tests := []struct {
+		symbol  string
+		want    OptionContract
+		wantErr bool
+	}{
+		{symbol: "AAPL  240119C00190000",
+			want: OptionContract{Underlying: "AAPL", Expiration: parseDate("2024-01-19"), PutCall: "C", Strike: 190_00}},
+		{symbol: "SPY   241220P00475500",
+			want: OptionContract{Underlying: "SPY", Expiration: parseDate("2024-12-20"), PutCall: "P", Strike: 475_50}},
+		{symbol: "GOOGL 250321C00002500",
+			want: OptionContract{Underlying: "GOOGL", Expiration: parseDate("2025-03-21"), PutCall: "C", Strike: 2_50}},
+		{symbol: "BRKB1 240621P01000000",
+			want: OptionContract{Underlying: "BRKB1", Expiration: parseDate("2024-06-21"), PutCall: "P",
+				Strike: 1_000_00}},
+		{symbol: "F240119C00012000",
+			want: OptionContract{Underlying: "F", Expiration: parseDate("2024-01-19"), PutCall: "C", Strike: 12_00}},
+		{symbol: "240119C00190000", wantErr: true},
+		{symbol: "AAPL", wantErr: true},
+		{symbol: "AAPL  241319C00190000", wantErr: true},
+		{symbol: "AAPL  240119X00190000", wantErr: true},
+		{symbol: "AAPL  240119C0019000A", wantErr: true},
+		{symbol: "AAPL  240119C-0190000", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			got, err := ParseOptionSymbol(tt.symbol)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOptionSymbol(%q) error = %v, wantErr %v", tt.symbol, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Underlying != tt.want.Underlying || !got.Expiration.Equal(tt.want.Expiration) ||
+				got.PutCall != tt.want.PutCall || got.Strike != tt.want.Strike {
+				t.Errorf("ParseOptionSymbol(%q) = %+v, want %+v", tt.symbol, got, tt.want)
+			}
+			if got.Expiration.Location() != time.UTC {
+				t.Errorf("expiration %s is not a UTC date", got.Expiration)
+			}
+		})
+	}
+}
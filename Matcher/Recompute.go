@@ -0,0 +1,113 @@
+package Matcher
+
+import (
+	"fmt"
+	"gains/Data"
+	"sort"
+)
+
+// BalanceChange is how recomputing an account changed its capital gains balance for one tax year
+type BalanceChange struct {
+	TaxYear int
+	Before  Data.CapitalGainsBalance
+	After   Data.CapitalGainsBalance
+}
+
+// String formats the change of the short-term, long-term and net balance in dollars
+func (c BalanceChange) String() string {
+	return fmt.Sprintf("%d  short-term $%.2f -> $%.2f  long-term $%.2f -> $%.2f  net $%.2f -> $%.2f", c.TaxYear,
+		float64(c.Before.ShortTermChange)/100, float64(c.After.ShortTermChange)/100,
+		float64(c.Before.LongTermChange)/100, float64(c.After.LongTermChange)/100,
+		float64(c.Before.NetCapitalChange)/100, float64(c.After.NetCapitalChange)/100)
+}
+
+// RecomputeAccount throws away every lot, ledger row and balance derived for the account and rebuilds them by
+// replaying its full transaction history through MatchOrders in activity order. Everything happens in one database
+// transaction so a failed replay leaves the previous state untouched. Balances imported from 1099s are not derived from
+// transaction_history and are carried over into the rebuilt balances.
+func RecomputeAccount(db *Data.DatabaseHelper, accountId int) ([]BalanceChange, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := tx.GetCapitalGainsBalancesByAccountID(accountId)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.ClearDerivedState(accountId); err != nil {
+		return nil, err
+	}
+
+	transactions, err := tx.GetTransactionsByAccountID(accountId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := MatchOrders(transactions, tx); err != nil {
+		return nil, err
+	}
+
+	after, err := tx.GetCapitalGainsBalancesByAccountID(accountId)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing recompute: %w", err)
+	}
+
+	return diffBalances(accountId, before, after), nil
+}
+
+// MatchUnmatched matches the account's transactions that no run has consumed yet and applies its pending corporate
+// actions and year-end marks, all in one database transaction so a failure leaves the lots and balances as they were.
+// The net change of every tax year the run touched is returned.
+func MatchUnmatched(db *Data.DatabaseHelper, accountId int) (map[int]int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transactions, err := tx.GetUnmatchedTransactionsByAccountID(accountId)
+	if err != nil {
+		return nil, err
+	}
+	netChanges, err := matchAccount(tx, accountId, transactions)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing match: %w", err)
+	}
+	return netChanges, nil
+}
+
+// diffBalances pairs up balances by tax year and returns the years whose totals changed
+func diffBalances(accountId int, before []Data.CapitalGainsBalance, after []Data.CapitalGainsBalance) []BalanceChange {
+	changes := make(map[int]*BalanceChange)
+	change := func(taxYear int) *BalanceChange {
+		if _, ok := changes[taxYear]; !ok {
+			empty := Data.CapitalGainsBalance{AccountId: accountId, TaxYear: taxYear}
+			changes[taxYear] = &BalanceChange{TaxYear: taxYear, Before: empty, After: empty}
+		}
+		return changes[taxYear]
+	}
+	for _, balance := range before {
+		change(balance.TaxYear).Before = balance
+	}
+	for _, balance := range after {
+		change(balance.TaxYear).After = balance
+	}
+
+	var diff []BalanceChange
+	for _, c := range changes {
+		if c.Before != c.After {
+			diff = append(diff, *c)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i].TaxYear < diff[j].TaxYear
+	})
+	return diff
+}
@@ -0,0 +1,48 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"reflect"
+	"testing"
+)
+
+func TestDiffBalances(t *testing.T) {
+	balance := func(taxYear int, shortTerm int64, longTerm int64) Data.CapitalGainsBalance {
+		return Data.CapitalGainsBalance{AccountId: 7, TaxYear: taxYear, ShortTermChange: shortTerm,
+			LongTermChange: longTerm, NetCapitalChange: shortTerm + longTerm}
+	}
+	empty := func(taxYear int) Data.CapitalGainsBalance {
+		return Data.CapitalGainsBalance{AccountId: 7, TaxYear: taxYear}
+	}
+	tests := []struct {
+		name   string
+		before []Data.CapitalGainsBalance
+		after  []Data.CapitalGainsBalance
+		want   []BalanceChange
+	}{
+		{name: "nothing changed",
+			before: []Data.CapitalGainsBalance{balance(2023, 100_00, 0)},
+			after:  []Data.CapitalGainsBalance{balance(2023, 100_00, 0)}},
+		{name: "a year's totals changed",
+			before: []Data.CapitalGainsBalance{balance(2022, 5_00, 0), balance(2023, 100_00, 0)},
+			after:  []Data.CapitalGainsBalance{balance(2022, 5_00, 0), balance(2023, 40_00, 60_00)},
+			want: []BalanceChange{
+				{TaxYear: 2023, Before: balance(2023, 100_00, 0), After: balance(2023, 40_00, 60_00)},
+			}},
+		{name: "a year appears and another disappears",
+			before: []Data.CapitalGainsBalance{balance(2024, -30_00, 0)},
+			after:  []Data.CapitalGainsBalance{balance(2021, 0, 12_00)},
+			want: []BalanceChange{
+				{TaxYear: 2021, Before: empty(2021), After: balance(2021, 0, 12_00)},
+				{TaxYear: 2024, Before: balance(2024, -30_00, 0), After: empty(2024)},
+			}},
+		{name: "nothing before or after"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffBalances(7, tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffBalances() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package Matcher
+
+import (
+	"fmt"
+	"gains/Data"
+	"gains/Data/JsonParser"
+	"math"
+	"sort"
+)
+
+// Kinds of difference between Schwab's positions and the open lots
+const (
+	// MissingLots is a position Schwab holds more of than the open lots, e.g. a missed buy or transfer
+	MissingLots = "MISSING_LOTS"
+	// ExtraLots is open lots holding more than Schwab does, e.g. a missed sale or expiration
+	ExtraLots = "EXTRA_LOTS"
+	// BasisDrift is a position whose quantity agrees but whose average cost does not, e.g. a missed corporate action
+	BasisDrift = "BASIS_DRIFT"
+	// TickerDrift is lots filed under a different ticker than Schwab reports for their CUSIP, e.g. a missed ticker
+	// change
+	TickerDrift = "TICKER_DRIFT"
+)
+
+// basisDriftTolerance is how far in cents per share the average cost of the lots may be from Schwab's before it is
+// reported, enough to absorb rounding of fees spread over the shares
+const basisDriftTolerance = 1
+
+// PositionDifference is a disagreement between Schwab and the open lots over one side of a symbol. Average prices are
+// per share in cents.
+type PositionDifference struct {
+	Kind               string
+	Symbol             string
+	Side               PositionSide
+	BrokerQuantity     Data.Quantity
+	LotQuantity        Data.Quantity
+	BrokerAveragePrice int64
+	LotAveragePrice    int64
+	// LotTicker is the ticker the lots are filed under when it differs from Symbol
+	LotTicker string
+}
+
+func (d PositionDifference) String() string {
+	switch d.Kind {
+	case TickerDrift:
+		return fmt.Sprintf("%s %s: %s shares filed under %s", d.Kind, d.Symbol, d.LotQuantity, d.LotTicker)
+	case BasisDrift:
+		return fmt.Sprintf("%s %s %s: Schwab average $%.2f, lots average $%.2f", d.Kind, d.Side, d.Symbol,
+			float64(d.BrokerAveragePrice)/100, float64(d.LotAveragePrice)/100)
+	default:
+		return fmt.Sprintf("%s %s %s: Schwab holds %s, lots hold %s", d.Kind, d.Side, d.Symbol, d.BrokerQuantity,
+			d.LotQuantity)
+	}
+}
+
+// brokerHolding is Schwab's quantity and average price of one side of a symbol
+type brokerHolding struct {
+	quantity     Data.Quantity
+	averagePrice int64
+}
+
+// lotHolding is the quantity, share count and total basis of the open lots on one side of a symbol
+type lotHolding struct {
+	quantity Data.Quantity
+	shares   Data.Quantity
+	basis    int64
+}
+
+// averagePrice returns the lots' cost per share in cents
+func (h lotHolding) averagePrice() int64 {
+	if h.shares == 0 {
+		return 0
+	}
+	return h.shares.PerShare(h.basis)
+}
+
+// ReconcilePositions compares Schwab's long and short quantity and average cost of every symbol against the account's
+// open lots and returns the differences, sorted by symbol
+func ReconcilePositions(db *Data.DatabaseHelper, accountId int, positions []JsonParser.Position) (
+	[]PositionDifference, error) {
+	lots, err := db.GetOpenTaxLotsByAccountID(accountId)
+	if err != nil {
+		return nil, err
+	}
+	return reconcileLots(lots, positions), nil
+}
+
+// reconcileLots compares Schwab's positions against open lots. Cash equivalents are not held in lots and are skipped.
+// Lots whose CUSIP Schwab reports under another symbol are compared under Schwab's symbol and reported as ticker drift.
+func reconcileLots(lots []Data.TaxLot, positions []JsonParser.Position) []PositionDifference {
+	broker := map[PositionSide]map[string]brokerHolding{LongPosition: {}, ShortPosition: {}}
+	symbolsByCusip := make(map[string]string)
+	for _, position := range positions {
+		instrument := position.Instrument
+		if instrument.AssetType == "CASH_EQUIVALENT" {
+			continue
+		}
+		if instrument.Cusip != "" {
+			symbolsByCusip[instrument.Cusip] = instrument.Symbol
+		}
+		if position.LongQuantity != 0 {
+			broker[LongPosition][instrument.Symbol] = brokerHolding{
+				quantity:     Data.QuantityFromFloat(position.LongQuantity),
+				averagePrice: int64(math.Round(position.LongAveragePrice() * 100)),
+			}
+		}
+		if position.ShortQuantity != 0 {
+			broker[ShortPosition][instrument.Symbol] = brokerHolding{
+				quantity:     Data.QuantityFromFloat(position.ShortQuantity),
+				averagePrice: int64(math.Round(position.ShortAveragePrice() * 100)),
+			}
+		}
+	}
+
+	var differences []PositionDifference
+	held := map[PositionSide]map[string]lotHolding{LongPosition: {}, ShortPosition: {}}
+	drifted := make(map[PositionDifference]Data.Quantity)
+	for _, lot := range lots {
+		side := PositionSide(lot.PositionSide)
+		symbol := lot.StockTicker
+		if brokerSymbol, ok := symbolsByCusip[lot.Cusip]; ok && lot.Cusip != "" && brokerSymbol != symbol {
+			drift := PositionDifference{Kind: TickerDrift, Symbol: brokerSymbol, Side: side, LotTicker: symbol}
+			drifted[drift] += lot.OpenQuantity
+			symbol = brokerSymbol
+		}
+		h := held[side][symbol]
+		shares := lot.OpenQuantity * Data.Quantity(lot.Multiplier)
+		h.quantity += lot.OpenQuantity
+		h.shares += shares
+		h.basis += shares.MulPrice(lot.CostPerShare) + lot.BasisAdjustment
+		held[side][symbol] = h
+	}
+	for drift, quantity := range drifted {
+		drift.LotQuantity = quantity
+		differences = append(differences, drift)
+	}
+
+	for _, side := range []PositionSide{LongPosition, ShortPosition} {
+		symbols := make(map[string]bool)
+		for symbol := range broker[side] {
+			symbols[symbol] = true
+		}
+		for symbol := range held[side] {
+			symbols[symbol] = true
+		}
+
+		for symbol := range symbols {
+			position, open := broker[side][symbol], held[side][symbol]
+			difference := PositionDifference{
+				Symbol:             symbol,
+				Side:               side,
+				BrokerQuantity:     position.quantity,
+				LotQuantity:        open.quantity,
+				BrokerAveragePrice: position.averagePrice,
+				LotAveragePrice:    open.averagePrice(),
+			}
+			switch {
+			case position.quantity > open.quantity:
+				difference.Kind = MissingLots
+			case position.quantity < open.quantity:
+				difference.Kind = ExtraLots
+			case abs(difference.BrokerAveragePrice-difference.LotAveragePrice) > basisDriftTolerance:
+				difference.Kind = BasisDrift
+			default:
+				continue
+			}
+			differences = append(differences, difference)
+		}
+	}
+
+	sort.SliceStable(differences, func(i, j int) bool {
+		a, b := differences[i], differences[j]
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		if a.Side != b.Side {
+			return a.Side < b.Side
+		}
+		return a.Kind > b.Kind
+	})
+	return differences
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,132 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"gains/Data/JsonParser"
+	"reflect"
+	"testing"
+)
+
+// heldLot builds an open lot of quantity shares or contracts of symbol at costPerShare
+func heldLot(symbol string, cusip string, side PositionSide, quantity Data.Quantity, costPerShare int64) Data.TaxLot {
+	lot := Data.TaxLot{
+		StockTicker:  symbol,
+		Cusip:        cusip,
+		OpenQuantity: quantity,
+		CostPerShare: costPerShare,
+		PositionSide: string(side),
+		Multiplier:   1,
+	}
+	if _, err := ParseOptionSymbol(symbol); err == nil {
+		lot.Multiplier = contractMultiplier
+	}
+	return lot
+}
+
+// longPosition is Schwab holding quantity of symbol bought at averagePrice a share
+func longPosition(symbol string, cusip string, quantity float64, averagePrice float64) JsonParser.Position {
+	return JsonParser.Position{
+		LongQuantity:           quantity,
+		TaxLotAverageLongPrice: averagePrice,
+		Instrument:             JsonParser.Instrument{AssetType: "EQUITY", Cusip: cusip, Symbol: symbol},
+	}
+}
+
+func TestReconcileLots(t *testing.T) {
+	tests := []struct {
+		name      string
+		lots      []Data.TaxLot
+		positions []JsonParser.Position
+		want      []PositionDifference
+	}{
+		{name: "lots agree with Schwab",
+			lots: []Data.TaxLot{
+				heldLot("VTI", "922908769", LongPosition, Data.Shares(10), 200_00),
+				heldLot("VTI", "922908769", LongPosition, 2_500_000, 220_00),
+			},
+			positions: []JsonParser.Position{longPosition("VTI", "922908769", 12.5, 204)}},
+		{name: "average cost within a cent per share",
+			lots: func() []Data.TaxLot {
+				lot := heldLot("VTI", "", LongPosition, Data.Shares(3), 100_00)
+				lot.BasisAdjustment = 1
+				return []Data.TaxLot{lot}
+			}(),
+			positions: []JsonParser.Position{longPosition("VTI", "", 3, 100.01)}},
+		{name: "Schwab holds more than the lots",
+			lots:      []Data.TaxLot{heldLot("VTI", "", LongPosition, Data.Shares(5), 200_00)},
+			positions: []JsonParser.Position{longPosition("VTI", "", 10, 200)},
+			want: []PositionDifference{{Kind: MissingLots, Symbol: "VTI", Side: LongPosition,
+				BrokerQuantity: Data.Shares(10), LotQuantity: Data.Shares(5), BrokerAveragePrice: 200_00,
+				LotAveragePrice: 200_00}}},
+		{name: "lots for a position Schwab does not hold",
+			lots: []Data.TaxLot{heldLot("AAPL", "", LongPosition, Data.Shares(2), 150_00)},
+			want: []PositionDifference{{Kind: ExtraLots, Symbol: "AAPL", Side: LongPosition,
+				LotQuantity: Data.Shares(2), LotAveragePrice: 150_00}}},
+		{name: "same quantity at a different average cost",
+			lots:      []Data.TaxLot{heldLot("VTI", "", LongPosition, Data.Shares(10), 90_00)},
+			positions: []JsonParser.Position{longPosition("VTI", "", 10, 100)},
+			want: []PositionDifference{{Kind: BasisDrift, Symbol: "VTI", Side: LongPosition,
+				BrokerQuantity: Data.Shares(10), LotQuantity: Data.Shares(10), BrokerAveragePrice: 100_00,
+				LotAveragePrice: 90_00}}},
+		{name: "short lots are compared against the short quantity",
+			lots: []Data.TaxLot{
+				heldLot("TSLA", "", ShortPosition, Data.Shares(5), 250_00),
+				heldLot("TSLA", "", LongPosition, Data.Shares(1), 200_00),
+			},
+			positions: []JsonParser.Position{{
+				ShortQuantity:           5,
+				TaxLotAverageShortPrice: 250,
+				Instrument:              JsonParser.Instrument{AssetType: "EQUITY", Symbol: "TSLA"},
+			}},
+			want: []PositionDifference{{Kind: ExtraLots, Symbol: "TSLA", Side: LongPosition,
+				LotQuantity: Data.Shares(1), LotAveragePrice: 200_00}}},
+		{name: "options count contracts and price per share",
+			lots: []Data.TaxLot{heldLot("AAPL  240119C00190000", "", LongPosition, Data.Shares(2), 1_50)},
+			positions: []JsonParser.Position{{
+				LongQuantity:           2,
+				TaxLotAverageLongPrice: 1.5,
+				Instrument:             JsonParser.Instrument{AssetType: "OPTION", Symbol: "AAPL  240119C00190000"},
+			}}},
+		{name: "lots filed under an old ticker",
+			lots:      []Data.TaxLot{heldLot("FB", "30303M102", LongPosition, Data.Shares(10), 300_00)},
+			positions: []JsonParser.Position{longPosition("META", "30303M102", 10, 300)},
+			want: []PositionDifference{{Kind: TickerDrift, Symbol: "META", Side: LongPosition,
+				LotQuantity: Data.Shares(10), LotTicker: "FB"}}},
+		{name: "cash equivalents are skipped",
+			positions: []JsonParser.Position{{
+				LongQuantity: 1_000,
+				AveragePrice: 1,
+				Instrument:   JsonParser.Instrument{AssetType: "CASH_EQUIVALENT", Symbol: "SWVXX"},
+			}}},
+		{name: "differences are sorted by symbol, side and kind",
+			lots: []Data.TaxLot{
+				heldLot("VTI", "", LongPosition, Data.Shares(1), 200_00),
+				heldLot("AAPL", "", ShortPosition, Data.Shares(1), 150_00),
+				heldLot("FB", "30303M102", LongPosition, Data.Shares(3), 300_00),
+			},
+			positions: []JsonParser.Position{
+				longPosition("META", "30303M102", 5, 300),
+				longPosition("AAPL", "", 2, 150),
+			},
+			want: []PositionDifference{
+				{Kind: MissingLots, Symbol: "AAPL", Side: LongPosition, BrokerQuantity: Data.Shares(2),
+					BrokerAveragePrice: 150_00},
+				{Kind: ExtraLots, Symbol: "AAPL", Side: ShortPosition, LotQuantity: Data.Shares(1),
+					LotAveragePrice: 150_00},
+				{Kind: TickerDrift, Symbol: "META", Side: LongPosition, LotQuantity: Data.Shares(3),
+					LotTicker: "FB"},
+				{Kind: MissingLots, Symbol: "META", Side: LongPosition, BrokerQuantity: Data.Shares(5),
+					LotQuantity: Data.Shares(3), BrokerAveragePrice: 300_00, LotAveragePrice: 300_00},
+				{Kind: ExtraLots, Symbol: "VTI", Side: LongPosition, LotQuantity: Data.Shares(1),
+					LotAveragePrice: 200_00},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reconcileLots(tt.lots, tt.positions)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reconcileLots() =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"gains/Data/JsonParser"
+	"log/slog"
+	"math"
+	"strings"
+)
+
+// IngestTransactions records activity from the transactions endpoint. Trades are stored like filled orders, but only
+// those without an order unless includeOrderTrades is set, so the endpoint can run alongside the orders feed or in
+// place of it. Dividends are recorded as income, options that expired, were exercised or were assigned are matched
+// right away, and securities received, delivered or journaled without a trade are logged so their lots can be entered
+// by hand. The number of trade rows inserted is returned so the caller knows whether to match the account.
+func IngestTransactions(db *Data.DatabaseHelper, accountId int, transactions []JsonParser.Transaction,
+	includeOrderTrades bool) (int64, error) {
+	var trades []JsonParser.Transaction
+	var others []JsonParser.Transaction
+	for _, transaction := range transactions {
+		if transaction.Status != "" && transaction.Status != "VALID" {
+			continue
+		}
+		if transaction.Type == JsonParser.TradeTransaction {
+			if transaction.OrderId == 0 || includeOrderTrades {
+				trades = append(trades, transaction)
+			}
+			continue
+		}
+		others = append(others, transaction)
+	}
+
+	rowsInserted, err := db.InsertTradeRecords(accountId, trades)
+	if err != nil {
+		return rowsInserted, err
+	}
+
+	for _, transaction := range others {
+		var err error
+		switch transaction.Type {
+		case JsonParser.DividendOrInterestTransaction:
+			err = ingestDividend(db, accountId, transaction)
+		case JsonParser.ReceiveAndDeliverTransaction:
+			err = ingestReceiveAndDeliver(db, accountId, transaction)
+		case JsonParser.JournalTransaction:
+			if len(transaction.Securities()) > 0 {
+				slog.Warn("Securities journaled between accounts are not moved between lots, enter them as manual lots",
+					"activityId", transaction.ActivityId, "description", transaction.Description)
+			}
+		}
+		if err != nil {
+			return rowsInserted, err
+		}
+	}
+	return rowsInserted, nil
+}
+
+// ingestDividend records a dividend paid on a security. Interest and dividends without a security are skipped.
+// Shares bought by reinvesting the dividend arrive as a separate TRADE without an order.
+func ingestDividend(db *Data.DatabaseHelper, accountId int, transaction JsonParser.Transaction) error {
+	securities := transaction.Securities()
+	if len(securities) == 0 {
+		if !strings.Contains(strings.ToUpper(transaction.Description), "INTEREST") {
+			slog.Warn("Dividend has no security", "activityId", transaction.ActivityId,
+				"description", transaction.Description)
+		}
+		return nil
+	}
+	payDate, err := transaction.TradeTime()
+	if err != nil {
+		return err
+	}
+
+	description := strings.ToUpper(transaction.Description)
+	dividendType := OrdinaryDividend
+	if strings.Contains(description, "QUALIFIED") && !strings.Contains(description, "NON-QUALIFIED") &&
+		!strings.Contains(description, "NON QUALIFIED") {
+		dividendType = QualifiedDividend
+	}
+
+	_, err = RecordDividend(db, Data.Dividend{
+		AccountId:    accountId,
+		ActivityId:   transaction.ActivityId,
+		StockTicker:  securities[0].Instrument.Symbol,
+		Cusip:        securities[0].Instrument.Cusip,
+		PayDate:      payDate,
+		Amount:       int64(math.Round(math.Abs(transaction.NetAmount) * 100)),
+		DividendType: dividendType,
+	})
+	return err
+}
+
+// ingestReceiveAndDeliver records options leaving the account through expiration, exercise or assignment. Stock
+// splits and transfers of shares are logged, since the basis they need has to come from a corporate action or a
+// manual lot.
+func ingestReceiveAndDeliver(db *Data.DatabaseHelper, accountId int, transaction JsonParser.Transaction) error {
+	description := strings.ToUpper(transaction.Description)
+	for _, item := range transaction.Securities() {
+		if item.Instrument.AssetType != "OPTION" {
+			if strings.Contains(description, "SPLIT") {
+				slog.Warn("Stock split received, record it with the corporateaction command",
+					"symbol", item.Instrument.Symbol, "activityId", transaction.ActivityId,
+					"description", transaction.Description)
+			} else {
+				slog.Warn("Securities received or delivered without a trade, enter them as manual lots",
+					"symbol", item.Instrument.Symbol, "activityId", transaction.ActivityId,
+					"description", transaction.Description)
+			}
+			continue
+		}
+
+		var eventType string
+		switch {
+		case strings.Contains(description, "EXPIR"):
+			eventType = "EXPIRATION"
+		case strings.Contains(description, "EXERCISE"):
+			eventType = "EXERCISE"
+		case strings.Contains(description, "ASSIGN"):
+			eventType = "ASSIGNMENT"
+		default:
+			slog.Warn("Unrecognized option delivery", "symbol", item.Instrument.Symbol,
+				"activityId", transaction.ActivityId, "description", transaction.Description)
+			continue
+		}
+
+		recorded, err := db.HasTransaction(accountId, transaction.ActivityId)
+		if err != nil {
+			return err
+		}
+		if recorded {
+			continue
+		}
+		date, err := transaction.TradeTime()
+		if err != nil {
+			return err
+		}
+		err = recordOptionEvent(db, accountId, transaction.ActivityId, item.Instrument.Symbol, eventType,
+			Data.QuantityFromFloat(math.Abs(item.Amount)), date)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"gains/Data/JsonParser"
+	"math"
+	"time"
+)
+
+// UnrealizedGain is what closing the open shares of a lot at the quoted price would realize. Amounts are in cents.
+type UnrealizedGain struct {
+	Lot Data.TaxLot
+	// Price is the quoted per share price the lot is valued at
+	Price       int64
+	MarketValue int64
+	// CostBasis is the basis of the open shares, for short lots the short sale proceeds less adjustments
+	CostBasis   int64
+	Gain        int64
+	HoldingTerm HoldingTerm
+}
+
+// UnrealizedGains is the unrealized gain of every open lot of an account that could be quoted, with the totals by
+// holding term
+type UnrealizedGains struct {
+	AccountId int
+	AsOf      time.Time
+	Lots      []UnrealizedGain
+	ShortTerm int64
+	LongTerm  int64
+	// Ordinary is the unrealized gain of an account marked to market, which is ordinary income at year end
+	Ordinary int64
+	// Unquoted lists the tickers of open lots without a quote, which are left out of the totals
+	Unquoted []string
+}
+
+// ComputeUnrealizedGains values the account's open lots at the quoted prices as if they were closed on asOf
+func ComputeUnrealizedGains(db *Data.DatabaseHelper, accountId int, quotes map[string]JsonParser.Quote,
+	asOf time.Time) (UnrealizedGains, error) {
+	lots, err := db.GetOpenTaxLotsByAccountID(accountId)
+	if err != nil {
+		return UnrealizedGains{}, err
+	}
+	markToMarketFrom, err := db.GetMarkToMarketFrom(accountId)
+	if err != nil {
+		return UnrealizedGains{}, err
+	}
+	markedToMarket := markToMarketFrom != 0 && TaxYear(asOf) >= markToMarketFrom
+
+	result := valueLots(lots, quotes, asOf, markedToMarket)
+	result.AccountId = accountId
+	return result, nil
+}
+
+// valueLots values open lots at the quoted prices as if they were closed on asOf. Long lots gain when the price is
+// above their basis and short lots when it is below their short sale proceeds. Holding terms and the basis of gifted
+// shares follow the rules a sale on that date would, and every gain is ordinary when the lots are marked to market.
+func valueLots(lots []Data.TaxLot, quotes map[string]JsonParser.Quote, asOf time.Time,
+	markedToMarket bool) UnrealizedGains {
+	date := dateOf(asOf)
+	result := UnrealizedGains{AsOf: asOf}
+	unquoted := make(map[string]bool)
+	for _, lot := range lots {
+		quote, ok := quotes[lot.StockTicker]
+		if !ok {
+			if !unquoted[lot.StockTicker] {
+				unquoted[lot.StockTicker] = true
+				result.Unquoted = append(result.Unquoted, lot.StockTicker)
+			}
+			continue
+		}
+		price := int64(math.Round(quote.Price() * 100))
+		shares := lot.OpenQuantity * Data.Quantity(lot.Multiplier)
+		openPrice := shares.MulPrice(lot.CostPerShare)
+		unrealized := UnrealizedGain{Lot: lot, Price: price, MarketValue: shares.MulPrice(price)}
+
+		if PositionSide(lot.PositionSide) == ShortPosition {
+			unrealized.HoldingTerm = ShortTerm
+			unrealized.CostBasis = openPrice - lot.BasisAdjustment
+			unrealized.Gain = unrealized.CostBasis - unrealized.MarketValue
+		} else {
+			unrealized.CostBasis, unrealized.HoldingTerm = giftedBasis(&lot, shares, openPrice+lot.BasisAdjustment,
+				unrealized.MarketValue, date, lotHoldingTerm(&lot, date))
+			unrealized.Gain = unrealized.MarketValue - unrealized.CostBasis
+		}
+		if markedToMarket {
+			unrealized.HoldingTerm = Ordinary
+		}
+
+		switch unrealized.HoldingTerm {
+		case Ordinary:
+			result.Ordinary += unrealized.Gain
+		case LongTerm:
+			result.LongTerm += unrealized.Gain
+		default:
+			result.ShortTerm += unrealized.Gain
+		}
+		result.Lots = append(result.Lots, unrealized)
+	}
+	return result
+}
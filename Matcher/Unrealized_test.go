@@ -0,0 +1,115 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"gains/Data/JsonParser"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// quotedLot builds an open lot of symbol opened at the start of the acquired trade date
+func quotedLot(symbol string, side PositionSide, acquired string, shares int, costPerShare int64) Data.TaxLot {
+	lot := *testLot(1, 101, acquired, shares, costPerShare)
+	lot.StockTicker = symbol
+	lot.PositionSide = string(side)
+	lot.AcquisitionDate = startOfTradeDate(lot.AcquisitionDate)
+	lot.HoldingPeriodStart = lot.AcquisitionDate
+	if _, err := ParseOptionSymbol(symbol); err == nil {
+		lot.Multiplier = contractMultiplier
+	}
+	return lot
+}
+
+func markQuote(mark float64) JsonParser.Quote {
+	return JsonParser.Quote{Quote: JsonParser.QuoteDetail{Mark: mark}}
+}
+
+func TestValueLots(t *testing.T) {
+	asOf := time.Date(2024, time.June, 3, 20, 0, 0, 0, time.UTC)
+	quotes := map[string]JsonParser.Quote{
+		"VTI":                   markQuote(250),
+		"AAPL":                  {Quote: JsonParser.QuoteDetail{LastPrice: 180, ClosePrice: 175}},
+		"TSLA":                  {Quote: JsonParser.QuoteDetail{ClosePrice: 200}},
+		"AAPL  240621C00190000": markQuote(2.25),
+		"F":                     markQuote(8),
+	}
+	tests := []struct {
+		name            string
+		lot             Data.TaxLot
+		wantPrice       int64
+		wantMarketValue int64
+		wantCostBasis   int64
+		wantGain        int64
+		wantTerm        HoldingTerm
+	}{
+		{name: "long gain held under a year", lot: quotedLot("VTI", LongPosition, "2024-01-10", 10, 200_00),
+			wantPrice: 250_00, wantMarketValue: 2_500_00, wantCostBasis: 2_000_00, wantGain: 500_00,
+			wantTerm: ShortTerm},
+		{name: "long loss held over a year with a basis adjustment", lot: func() Data.TaxLot {
+			lot := quotedLot("AAPL", LongPosition, "2022-05-02", 5, 200_00)
+			lot.BasisAdjustment = 10_00
+			return lot
+		}(), wantPrice: 180_00, wantMarketValue: 900_00, wantCostBasis: 1_010_00, wantGain: -110_00,
+			wantTerm: LongTerm},
+		{name: "short lot gains when the price falls and is always short term", lot: func() Data.TaxLot {
+			lot := quotedLot("TSLA", ShortPosition, "2022-05-02", 4, 250_00)
+			lot.BasisAdjustment = 5_00
+			return lot
+		}(), wantPrice: 200_00, wantMarketValue: 800_00, wantCostBasis: 995_00, wantGain: 195_00,
+			wantTerm: ShortTerm},
+		{name: "option contracts cover 100 shares",
+			lot:       quotedLot("AAPL  240621C00190000", LongPosition, "2024-05-01", 2, 1_50),
+			wantPrice: 2_25, wantMarketValue: 450_00, wantCostBasis: 300_00, wantGain: 150_00, wantTerm: ShortTerm},
+		{name: "gift valued below the donor's basis", lot: func() Data.TaxLot {
+			lot := quotedLot("F", LongPosition, "2024-03-01", 100, 12_00)
+			lot.AcquisitionType = GiftAcquisition
+			lot.FairMarketValue = 10_00
+			lot.HoldingPeriodStart = startOfTradeDate(parseDate("2019-03-01"))
+			return lot
+		}(), wantPrice: 8_00, wantMarketValue: 800_00, wantCostBasis: 1_000_00, wantGain: -200_00,
+			wantTerm: ShortTerm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := valueLots([]Data.TaxLot{tt.lot}, quotes, asOf, false)
+			if len(result.Lots) != 1 {
+				t.Fatalf("valueLots() valued %d lots, want 1", len(result.Lots))
+			}
+			got := result.Lots[0]
+			if got.Price != tt.wantPrice || got.MarketValue != tt.wantMarketValue ||
+				got.CostBasis != tt.wantCostBasis || got.Gain != tt.wantGain || got.HoldingTerm != tt.wantTerm {
+				t.Errorf("valueLots() = price %d, value %d, basis %d, gain %d, %s, want %d, %d, %d, %d, %s",
+					got.Price, got.MarketValue, got.CostBasis, got.Gain, got.HoldingTerm, tt.wantPrice,
+					tt.wantMarketValue, tt.wantCostBasis, tt.wantGain, tt.wantTerm)
+			}
+		})
+	}
+
+	lots := []Data.TaxLot{
+		quotedLot("VTI", LongPosition, "2024-01-10", 10, 200_00),
+		quotedLot("AAPL", LongPosition, "2022-05-02", 5, 200_00),
+		quotedLot("XYZ", LongPosition, "2024-01-10", 1, 10_00),
+		quotedLot("TSLA", ShortPosition, "2024-05-01", 4, 250_00),
+		quotedLot("XYZ", LongPosition, "2024-02-10", 1, 10_00),
+	}
+	result := valueLots(lots, quotes, asOf, false)
+	if result.ShortTerm != 500_00+200_00 || result.LongTerm != -100_00 || result.Ordinary != 0 {
+		t.Errorf("totals = %d short, %d long, %d ordinary, want 70000, -10000 and 0", result.ShortTerm,
+			result.LongTerm, result.Ordinary)
+	}
+	if len(result.Lots) != 3 || !reflect.DeepEqual(result.Unquoted, []string{"XYZ"}) {
+		t.Errorf("valued %d lots leaving %v unquoted, want 3 and [XYZ]", len(result.Lots), result.Unquoted)
+	}
+
+	result = valueLots(lots, quotes, asOf, true)
+	if result.ShortTerm != 0 || result.LongTerm != 0 || result.Ordinary != 600_00 {
+		t.Errorf("marked to market totals = %d short, %d long, %d ordinary, want 0, 0 and 60000", result.ShortTerm,
+			result.LongTerm, result.Ordinary)
+	}
+	for _, lot := range result.Lots {
+		if lot.HoldingTerm != Ordinary {
+			t.Errorf("lot of %s marked to market is %s, want %s", lot.Lot.StockTicker, lot.HoldingTerm, Ordinary)
+		}
+	}
+}
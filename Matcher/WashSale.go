@@ -0,0 +1,163 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"sort"
+	"time"
+)
+
+// washSaleWindowDays is how many days before or after a loss sale a purchase of the same security makes it a wash sale
+const washSaleWindowDays = 30
+
+// withinWashSaleWindow reports whether a purchase falls within 30 calendar days before or after a sale
+func withinWashSaleWindow(sale time.Time, purchase time.Time) bool {
+	days := dateOf(purchase).Sub(dateOf(sale)).Hours() / 24
+	return days >= -washSaleWindowDays && days <= washSaleWindowDays
+}
+
+// washSaleWindow returns the first and last instant of the sales a purchase on acquired can wash, every sale from 30
+// calendar days before through 30 calendar days after its trade date
+func washSaleWindow(acquired time.Time) (time.Time, time.Time) {
+	from := startOfTradeDate(dateOf(acquired).AddDate(0, 0, -washSaleWindowDays))
+	to := startOfTradeDate(dateOf(acquired).AddDate(0, 0, washSaleWindowDays+1)).Add(-time.Nanosecond)
+	return from, to
+}
+
+// disallowedPortion returns the part of a loss disallowed when washed more shares of the sale are matched to
+// replacement shares after alreadyWashed were
+func disallowedPortion(loss int64, quantity Data.Quantity, alreadyWashed Data.Quantity, washed Data.Quantity) int64 {
+	return prorate(-loss, quantity, alreadyWashed, washed)
+}
+
+// splitLot splits quantity open shares off a lot into a child lot so they can carry their own basis and holding
+// period. The lot itself is returned when all of its open shares are requested.
+func splitLot(db *Data.DatabaseHelper, lot *Data.TaxLot, quantity Data.Quantity) (*Data.TaxLot, error) {
+	if quantity >= lot.OpenQuantity {
+		return lot, nil
+	}
+
+	child := *lot
+	child.LotId = 0
+	child.ParentLotId = lot.LotId
+	child.OriginalQuantity = quantity
+	child.OpenQuantity = quantity
+	child.BasisAdjustment = quantity.Portion(lot.BasisAdjustment, lot.OpenQuantity)
+
+	lot.BasisAdjustment -= child.BasisAdjustment
+	lot.OriginalQuantity -= quantity
+	lot.OpenQuantity -= quantity
+	if err := db.UpdateTaxLot(*lot); err != nil {
+		return nil, err
+	}
+
+	inserted, err := db.InsertTaxLot(child)
+	if err != nil {
+		return nil, err
+	}
+	return &inserted, nil
+}
+
+// applyWashSale adds a disallowed loss to the basis of replacement shares, tacks the holding period of the sold
+// shares onto them and flags the lot so its shares are not used as replacement shares twice
+func applyWashSale(db *Data.DatabaseHelper, replacement *Data.TaxLot, disallowedLoss int64,
+	soldHoldingPeriodStart time.Time, saleDate time.Time) error {
+	replacement.BasisAdjustment += disallowedLoss
+	replacement.HoldingPeriodStart = tackHoldingPeriod(replacement.AcquisitionDate, soldHoldingPeriodStart, saleDate)
+	replacement.WashSaleReplacement = true
+	return db.UpdateTaxLot(*replacement)
+}
+
+// tackHoldingPeriod returns the holding period start of replacement shares bought on acquired, moved back by how long
+// the washed shares were held from soldHoldingPeriodStart until they were sold on saleDate
+func tackHoldingPeriod(acquired time.Time, soldHoldingPeriodStart time.Time, saleDate time.Time) time.Time {
+	return acquired.Add(-saleDate.Sub(soldHoldingPeriodStart))
+}
+
+// washSaleAtSale looks for replacement shares among the lots already held when a loss is matched. Shares from the
+// same purchase as the sold lot and shares received as a gift or inheritance are not replacement shares. It returns
+// the disallowed part of the loss, how many sold shares were washed and any lots split off for replacement shares.
+func washSaleAtSale(db *Data.DatabaseHelper, sell Data.TransactionData, allocation lotAllocation, loss int64,
+	lots []*Data.TaxLot) (int64, Data.Quantity, []*Data.TaxLot, error) {
+	var candidates []*Data.TaxLot
+	for _, lot := range lots {
+		if lot.OpenQuantity > 0 && !lot.WashSaleReplacement && lot.ActivityId != allocation.lot.ActivityId &&
+			purchased(lot) && withinWashSaleWindow(sell.ActivityDate, lot.AcquisitionDate) {
+			candidates = append(candidates, lot)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].AcquisitionDate.Before(candidates[j].AcquisitionDate)
+	})
+
+	var disallowedLoss int64
+	var washed Data.Quantity
+	var splitLots []*Data.TaxLot
+	for _, candidate := range candidates {
+		if washed == allocation.quantity {
+			break
+		}
+		quantity := min(allocation.quantity-washed, candidate.OpenQuantity)
+		replacement, err := splitLot(db, candidate, quantity)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if replacement != candidate {
+			splitLots = append(splitLots, replacement)
+		}
+
+		portion := disallowedPortion(loss, allocation.quantity, washed, quantity)
+		err = applyWashSale(db, replacement, portion, allocation.lot.HoldingPeriodStart, sell.ActivityDate)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		disallowedLoss += portion
+		washed += quantity
+	}
+	return disallowedLoss, washed, splitLots, nil
+}
+
+// washSaleAtPurchase applies the wash sale rule retroactively to losses realized up to 30 days before or after a new
+// lot was acquired. The disallowed losses are backed out of the capital gains balance of the year they were booked
+// in. It returns the total disallowed loss and any lots split off for replacement shares.
+func washSaleAtPurchase(db *Data.DatabaseHelper, lot *Data.TaxLot) (int64, []*Data.TaxLot, error) {
+	from, to := washSaleWindow(lot.AcquisitionDate)
+	candidates, err := db.GetWashSaleCandidates(lot.AccountId, lot.StockTicker, from, to)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var disallowedLoss int64
+	var splitLots []*Data.TaxLot
+	for _, candidate := range candidates {
+		if lot.OpenQuantity == 0 || lot.WashSaleReplacement {
+			break
+		}
+		quantity := min(candidate.Quantity-candidate.WashSaleQuantity, lot.OpenQuantity)
+		replacement, err := splitLot(db, lot, quantity)
+		if err != nil {
+			return 0, nil, err
+		}
+		if replacement != lot {
+			splitLots = append(splitLots, replacement)
+		}
+
+		portion := disallowedPortion(candidate.Gain, candidate.Quantity, candidate.WashSaleQuantity, quantity)
+		err = applyWashSale(db, replacement, portion, candidate.HoldingPeriodStart, candidate.SellDate)
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := db.AddWashSaleAdjustment(candidate.GainId, portion, quantity); err != nil {
+			return 0, nil, err
+		}
+		shortTerm, longTerm := portion, int64(0)
+		if HoldingTerm(candidate.HoldingTerm) == LongTerm {
+			shortTerm, longTerm = 0, portion
+		}
+		err = db.UpsertCapitalGainsBalance(lot.AccountId, TaxYear(candidate.SellDate), shortTerm, longTerm, 0)
+		if err != nil {
+			return 0, nil, err
+		}
+		disallowedLoss += portion
+	}
+	return disallowedLoss, splitLots, nil
+}
@@ -0,0 +1,194 @@
+package Matcher
+
+import (
+	"gains/Data"
+	"testing"
+	"time"
+)
+
+func TestWithinWashSaleWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		sale     time.Time
+		purchase time.Time
+		want     bool
+	}{
+		{"same day", parseDate("2024-06-15"), parseDate("2024-06-15"), true},
+		{"30 days before", parseDate("2024-06-15"), parseDate("2024-05-16"), true},
+		{"31 days before", parseDate("2024-06-15"), parseDate("2024-05-15"), false},
+		{"30 days after", parseDate("2024-06-15"), parseDate("2024-07-15"), true},
+		{"31 days after", parseDate("2024-06-15"), parseDate("2024-07-16"), false},
+		{"30 days after across a leap day", parseDate("2024-02-10"), parseDate("2024-03-11"), true},
+		{"31 days after across a leap day", parseDate("2024-02-10"), parseDate("2024-03-12"), false},
+		{"across the end of daylight saving time",
+			time.Date(2024, time.October, 15, 19, 0, 0, 0, time.UTC),
+			time.Date(2024, time.November, 14, 20, 30, 0, 0, time.UTC), true},
+		{"evening fill counts on its Eastern trade date",
+			time.Date(2024, time.June, 15, 14, 0, 0, 0, time.UTC),
+			time.Date(2024, time.July, 16, 1, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withinWashSaleWindow(tt.sale, tt.purchase); got != tt.want {
+				t.Errorf("withinWashSaleWindow(%s, %s) = %v, want %v", tt.sale, tt.purchase, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWashSaleWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		acquired time.Time
+		wantFrom time.Time
+		wantTo   time.Time
+	}{
+		{"purchase at the open", startOfTradeDate(parseDate("2024-06-15")), startOfTradeDate(parseDate("2024-05-16")),
+			startOfTradeDate(parseDate("2024-07-16")).Add(-time.Nanosecond)},
+		{"purchase during the day", parseDate("2024-06-15").Add(15 * time.Hour),
+			startOfTradeDate(parseDate("2024-05-16")), startOfTradeDate(parseDate("2024-07-16")).Add(-time.Nanosecond)},
+		{"evening fill counts on its Eastern trade date", time.Date(2024, time.July, 16, 1, 0, 0, 0, time.UTC),
+			startOfTradeDate(parseDate("2024-06-15")), startOfTradeDate(parseDate("2024-08-15")).Add(-time.Nanosecond)},
+		{"across a leap day", startOfTradeDate(parseDate("2024-03-10")), startOfTradeDate(parseDate("2024-02-09")),
+			startOfTradeDate(parseDate("2024-04-10")).Add(-time.Nanosecond)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := washSaleWindow(tt.acquired)
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Errorf("washSaleWindow(%s) = %s, %s, want %s, %s", tt.acquired, from, to, tt.wantFrom, tt.wantTo)
+			}
+			// Every sale the window covers is one withinWashSaleWindow accepts
+			for _, sale := range []time.Time{from, to} {
+				if !withinWashSaleWindow(sale, tt.acquired) {
+					t.Errorf("sale at %s is in the window but not within 30 days of %s", sale, tt.acquired)
+				}
+			}
+			for _, sale := range []time.Time{from.Add(-time.Nanosecond), to.Add(time.Nanosecond)} {
+				if withinWashSaleWindow(sale, tt.acquired) {
+					t.Errorf("sale at %s is outside the window but within 30 days of %s", sale, tt.acquired)
+				}
+			}
+		})
+	}
+}
+
+func TestDisallowedPortion(t *testing.T) {
+	tests := []struct {
+		name          string
+		loss          int64
+		quantity      Data.Quantity
+		alreadyWashed Data.Quantity
+		washed        Data.Quantity
+		want          int64
+	}{
+		{"whole sale washed", -300_00, Data.Shares(10), 0, Data.Shares(10), 300_00},
+		{"part of the sale washed", -300_00, Data.Shares(10), 0, Data.Shares(4), 120_00},
+		{"second replacement lot", -300_00, Data.Shares(10), Data.Shares(4), Data.Shares(6), 180_00},
+		{"rounding left for the last share", -100_00, Data.Shares(3), Data.Shares(2), Data.Shares(1), 33_34},
+		{"fractional shares", -10_00, Data.Shares(1), 0, 250_000, 2_50},
+		{"nothing washed", -300_00, Data.Shares(10), 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := disallowedPortion(tt.loss, tt.quantity, tt.alreadyWashed, tt.washed)
+			if got != tt.want {
+				t.Errorf("disallowedPortion(%d, %s, %s, %s) = %d, want %d", tt.loss, tt.quantity,
+					tt.alreadyWashed, tt.washed, got, tt.want)
+			}
+		})
+	}
+
+	// Washing the sale one share at a time disallows exactly the whole loss
+	var total int64
+	for washed := Data.Quantity(0); washed < Data.Shares(7); washed += Data.Shares(1) {
+		total += disallowedPortion(-100_00, Data.Shares(7), washed, Data.Shares(1))
+	}
+	if total != 100_00 {
+		t.Errorf("disallowed %d in total, want %d", total, 100_00)
+	}
+}
+
+func TestTackedHoldingPeriod(t *testing.T) {
+	noon := func(s string) time.Time {
+		return parseDate(s).Add(16 * time.Hour)
+	}
+	tests := []struct {
+		name        string
+		soldStart   string
+		saleDate    string
+		replacement string
+		sold        string
+		want        HoldingTerm
+	}{
+		{"short holding becomes long with the tacked period", "2023-01-10", "2023-11-10", "2023-11-20",
+			"2024-01-25", LongTerm},
+		{"tacked period still short", "2023-06-01", "2023-11-10", "2023-11-20", "2024-01-15", ShortTerm},
+		{"tacked onto the anniversary is still short", "2023-01-10", "2023-06-10", "2023-06-20",
+			"2024-01-20", ShortTerm},
+		{"tacked onto the day after the anniversary", "2023-01-10", "2023-06-10", "2023-06-20",
+			"2024-01-21", LongTerm},
+		{"tacked across a leap day", "2023-03-01", "2024-02-01", "2024-02-15", "2024-03-16", LongTerm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tackHoldingPeriod(noon(tt.replacement), noon(tt.soldStart), noon(tt.saleDate))
+			if got := ClassifyHoldingTerm(start, parseDate(tt.sold)); got != tt.want {
+				t.Errorf("sale on %s of shares held from %s = %s, want %s", tt.sold,
+					dateOf(start).Format(time.DateOnly), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGiftsAndInheritancesAreNotReplacementShares(t *testing.T) {
+	// 10 shares bought in January are sold at a $300 loss on June 3rd
+	sold := acquiredLot(PurchaseAcquisition, "2024-01-10", "2024-01-10")
+	sell := Data.TransactionData{ShareCount: Data.Shares(10), ActivityDate: startOfTradeDate(parseDate("2024-06-03")),
+		OrderType: "SELL"}
+	allocation := lotAllocation{lot: sold, quantity: Data.Shares(10)}
+
+	tests := []struct {
+		name            string
+		acquisitionType string
+		want            bool
+	}{
+		{"purchase", PurchaseAcquisition, true},
+		{"lot recorded before acquisition types", "", true},
+		{"gift", GiftAcquisition, false},
+		{"inheritance", InheritanceAcquisition, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := acquiredLot(tt.acquisitionType, "2024-06-10", "2020-03-01")
+			received.ActivityId = 202
+			m := &matcher{}
+			if got := m.replacesPriorLosses(received); got != tt.want {
+				t.Errorf("replacesPriorLosses() = %v, want %v", got, tt.want)
+			}
+			if tt.want {
+				return
+			}
+
+			// Received a week after the loss and still held when the loss is matched, the shares wash none of it
+			disallowed, washed, splitLots, err := washSaleAtSale(nil, sell, allocation, -300_00,
+				[]*Data.TaxLot{received})
+			if err != nil || disallowed != 0 || washed != 0 || len(splitLots) != 0 {
+				t.Errorf("washSaleAtSale() = %d, %s, %d lots, %v, want the loss fully deductible", disallowed,
+					washed, len(splitLots), err)
+			}
+			if received.WashSaleReplacement || received.BasisAdjustment != 0 {
+				t.Errorf("%s lot adjusted as a replacement: %+v", tt.acquisitionType, *received)
+			}
+		})
+	}
+
+	short := acquiredLot(PurchaseAcquisition, "2024-06-10", "2024-06-10")
+	short.PositionSide = string(ShortPosition)
+	if (&matcher{}).replacesPriorLosses(short) {
+		t.Error("a short sale replaces prior losses")
+	}
+	if (&matcher{markToMarketFrom: 2024}).replacesPriorLosses(sold) {
+		t.Error("a purchase in a year marked to market replaces prior losses")
+	}
+}
@@ -12,6 +12,16 @@ type Config struct {
 	DBConnectionString string `json:"DBConnectionString"`
 	BearerToken        string `json:"BearerToken"`
 	RefreshToken       string `json:"RefreshToken"`
+	// TransactionSource is where trades are read from: "orders" (the default) for the orders endpoint, "transactions"
+	// for the transactions endpoint, or "both" to read trades from orders and everything else from transactions
+	TransactionSource string `json:"TransactionSource"`
+	// MaxRetries is how many times a Schwab request failing with a server or network error, or rate limited, is
+	// retried. Unset keeps the default of 3 and 0 turns retries off.
+	MaxRetries *int `json:"MaxRetries"`
+	// RetryBaseDelayMs is the wait before the first retry in milliseconds, doubling for each retry after it
+	RetryBaseDelayMs int `json:"RetryBaseDelayMs"`
+	// RetryMaxDelayMs caps the wait between retries in milliseconds
+	RetryMaxDelayMs int `json:"RetryMaxDelayMs"`
 }
 
 // LoadConfig reads the configuration from the JSON file
@@ -30,6 +40,27 @@ func LoadConfig(filename string) (*Config, error) {
 	return config, nil
 }
 
+// Transaction sources
+const (
+	OrdersSource       = "orders"
+	TransactionsSource = "transactions"
+	BothSources        = "both"
+)
+
+// RecomputeRequest is the key of a kafka message asking the consumer to recompute its account, the way the recompute
+// command does, without stopping it
+const RecomputeRequest = "recompute"
+
+// ReadsOrders reports whether trades come from the orders endpoint
+func (c *Config) ReadsOrders() bool {
+	return c.TransactionSource != TransactionsSource
+}
+
+// ReadsTransactions reports whether the transactions endpoint is polled
+func (c *Config) ReadsTransactions() bool {
+	return c.TransactionSource == TransactionsSource || c.TransactionSource == BothSources
+}
+
 // SaveConfig writes the configuration back to the JSON file
 func SaveConfig(filename string, config *Config) error {
 	data, err := json.MarshalIndent(config, "", "  ")
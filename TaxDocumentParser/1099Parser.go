@@ -4,6 +4,7 @@ import (
 	"encoding/csv"
 	"fmt"
 	"gains/Data"
+	"gains/Matcher"
 	"log"
 	"os"
 	"strconv"
@@ -26,11 +27,12 @@ func Import1099(accountId int, db *Data.DatabaseHelper) {
 		log.Fatal(err)
 	}
 
-	// Initialize grand total for tax year, and the tax year
+	// Initialize grand totals for tax year, and the tax year
 	var grandTotal float64
+	var longTermTotal float64
 	var taxYear int
 
-	// Iterate over rows and calculate short-term capital gains/losses
+	// Iterate over rows and calculate short-term and long-term capital gains/losses
 	for i, record := range records {
 		// Skip header
 		if i == 0 {
@@ -47,12 +49,9 @@ func Import1099(accountId int, db *Data.DatabaseHelper) {
 			log.Fatalf("Error parsing sold_date on row %d: %v", i, err)
 		}
 		if taxYear == 0 {
-			taxYear = acquiredDate.Year()
+			taxYear = soldDate.Year()
 		}
 
-		// Calculate holding period in days
-		holdingPeriod := soldDate.Sub(acquiredDate).Hours() / 24
-
 		// Parse proceeds and cost
 		var proceeds float64
 		proceeds, err = strconv.ParseFloat(record[7], 64)
@@ -65,15 +64,39 @@ func Import1099(accountId int, db *Data.DatabaseHelper) {
 
 		// Calculate gain or loss
 		gainOrLoss := proceeds
-		if holdingPeriod <= 365 {
+		if Matcher.ClassifyHoldingTerm(acquiredDate, soldDate) == Matcher.ShortTerm {
 			fmt.Printf("Row %d: Short-term gain/loss: $%.2f\n", i, gainOrLoss)
 			grandTotal += gainOrLoss
+		} else {
+			fmt.Printf("Row %d: Long-term gain/loss: $%.2f\n", i, gainOrLoss)
+			longTermTotal += gainOrLoss
 		}
 	}
 
 	// Print the grand total
 	fmt.Printf("Grand Total Short-term Gain/Loss: $%.2f\n", grandTotal)
-	db.UpsertCapitalGainsBalance(accountId, taxYear, int64(grandTotal*100), 0)
+	fmt.Printf("Grand Total Long-term Gain/Loss: $%.2f\n", longTermTotal)
+
+	// Record the imported figures next to the balance so a recompute of the account keeps them
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer tx.Rollback()
+	err = tx.RecordImportedCapitalGains(accountId, taxYear, int64(grandTotal*100), int64(longTermTotal*100))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = tx.UpsertCapitalGainsBalance(accountId, taxYear, int64(grandTotal*100), int64(longTermTotal*100), 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := Matcher.ComputeCapitalLossCarryovers(tx, accountId); err != nil {
+		log.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 // Remove commas from the string and return the cleaned string as a float
@@ -147,7 +147,7 @@ func (tm *TokenManager) RefreshTokens() error {
 
 	req, err := http.NewRequest("POST", "https://api.schwabapi.com/v1/oauth/token", strings.NewReader(payload.Encode()))
 	if err != nil {
-		slog.Error("Error creating new request:", err)
+		slog.Error("Error creating new request", "error", err)
 		return err
 	}
 
@@ -158,14 +158,14 @@ func (tm *TokenManager) RefreshTokens() error {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		slog.Error("Error executing request:", err)
+		slog.Error("Error executing request", "error", err)
 		return err
 	}
 	defer resp.Body.Close()
 
 	var tokens map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
-		slog.Error("Error parsing response body:", err)
+		slog.Error("Error parsing response body", "error", err)
 		return err
 	}
 
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gains/Data"
+	"gains/Matcher"
+	"gains/Properties"
+	"log"
+	"math"
+	"strings"
+)
+
+// carryover records the filing status and taxable income the capital loss carryover depends on, recomputes the
+// account's carryovers and prints the Capital Loss Carryover Worksheet for every year with a loss to carry
+func main() {
+	accountId := flag.Int("account", 0, "Schwab account number")
+	filingStatus := flag.String("filing-status", "", "SINGLE, MFJ, MFS, HOH or QSS")
+	taxYear := flag.Int("year", 0, "Tax year the taxable income was reported for")
+	taxableIncome := flag.Float64("taxable-income", math.NaN(), "Taxable income reported for -year, may be negative")
+	flag.Parse()
+	if *accountId == 0 {
+		log.Fatal("An account number is required, e.g. -account 12345678")
+	}
+
+	config, err := Properties.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	db, err := Data.NewDatabaseHelperFromConnectionString(config.DBConnectionString)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+
+	if *filingStatus != "" {
+		status := strings.ToUpper(*filingStatus)
+		if !Matcher.ValidFilingStatus(status) {
+			log.Fatalf("Unknown filing status %q", *filingStatus)
+		}
+		if err := db.SetFilingStatus(*accountId, status); err != nil {
+			log.Fatalf("Could not set filing status: %v", err)
+		}
+	}
+	if !math.IsNaN(*taxableIncome) {
+		if *taxYear == 0 {
+			log.Fatal("A tax year is required with -taxable-income, e.g. -year 2024")
+		}
+		if err := db.SetTaxableIncome(*accountId, *taxYear, int64(math.Round(*taxableIncome*100))); err != nil {
+			log.Fatalf("Could not set taxable income: %v", err)
+		}
+	}
+
+	worksheets, err := Matcher.ComputeCapitalLossCarryovers(db, *accountId)
+	if err != nil {
+		log.Fatalf("Computing carryovers failed: %v", err)
+	}
+	if len(worksheets) == 0 {
+		fmt.Printf("Account %d has no capital loss to carry over\n", *accountId)
+		return
+	}
+
+	dollars := func(cents int64) string {
+		return fmt.Sprintf("$%.2f", float64(cents)/100)
+	}
+	for _, w := range worksheets {
+		line1 := "not recorded"
+		if w.Line1 != nil {
+			line1 = dollars(*w.Line1)
+		}
+		fmt.Printf("Capital Loss Carryover Worksheet for %d (%s)\n", w.TaxYear, w.FilingStatus)
+		fmt.Printf("  1. Taxable income for %d: %s\n", w.TaxYear-1, line1)
+		for i, amount := range []int64{w.Line2, w.Line3, w.Line4, w.Line5, w.Line6, w.Line7, w.Line8, w.Line9,
+			w.Line10, w.Line11, w.Line12, w.Line13} {
+			fmt.Printf("%3d. %s\n", i+2, dollars(amount))
+		}
+		fmt.Printf("  Short-term carryover to %d: %s, long-term carryover: %s\n", w.TaxYear, dollars(w.Line8),
+			dollars(w.Line13))
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 	"gains/Data"
 	"gains/Endpoints"
+	"gains/Matcher"
 	"gains/Properties"
 
 	"os"
@@ -41,12 +42,13 @@ func main() {
 	if err != nil {
 		log.Fatalf("Could not load config: %v", err)
 	}
+	Endpoints.ConfigureRetries(config)
 	tm := TokenManager.NewTokenManager(config.AppKey, config.AppSecret)
 
 	//Initialize Schwab api struct by grabbing tokens and get account numbers for this user
-	schwabAPI, err := initializeTokens(config, tm)
+	schwabAPI, err := Endpoints.InitializeTokens(config, tm)
 	if err != nil {
-		slog.Error("Failed to initialize tokens:", err)
+		slog.Error("Failed to initialize tokens", "error", err)
 	}
 	accountNumbers, _ := schwabAPI.GetAccountNumbers()
 	if accountNumbers.HashValue == "" {
@@ -69,25 +71,52 @@ func main() {
 				log.Printf("failed to read message: %v", err)
 				return
 			}
-			var orders []JsonParser.Order
-			err = json.Unmarshal(msg.Value, &orders)
-			if err != nil {
-				slog.Warn("Error parsing JSON: %v", err)
-				continue
+			var rowsInserted int64
+			closing := false
+			if string(msg.Key) == Properties.RecomputeRequest {
+				recomputeAccount(db, accountNumber)
+			} else if string(msg.Key) == Properties.TransactionsSource {
+				transactions, err := JsonParser.ParseTransactions(msg.Value)
+				if err != nil {
+					slog.Warn("Error parsing JSON", "error", err)
+					continue
+				}
+				rowsInserted, err = Matcher.IngestTransactions(db, accountNumber, transactions,
+					!config.ReadsOrders())
+				if err != nil {
+					slog.Error("Error ingesting transactions", "error", err)
+				}
+				closing = rowsInserted > 0
+			} else if config.ReadsOrders() {
+				var orders []JsonParser.Order
+				err = json.Unmarshal(msg.Value, &orders)
+				if err != nil {
+					slog.Warn("Error parsing JSON", "error", err)
+					continue
+				}
+				rowsInserted = db.InsertTransactionData(orders)
+				closing = containsClosingOrder(orders)
 			}
-			rowsInserted := db.InsertTransactionData(orders)
 			if rowsInserted == 0 {
 				continue
 			}
-			if containsSellOrder(orders) {
-				transactions, err := db.GetUnmatchedTransactionsByAccountID(accountNumber)
+			if closing {
+				netChanges, err := Matcher.MatchUnmatched(db, accountNumber)
 				if err != nil {
-					slog.Error("Error getting transactions for ticker:", err)
+					slog.Error("Error matching transactions, they stay unmatched for the next run", "error", err)
+				}
+				years := make([]int, 0, len(netChanges))
+				for year := range netChanges {
+					years = append(years, year)
+				}
+				sort.Ints(years)
+				for _, year := range years {
+					capitalGains := db.GetCapitalGainsBalanceForYear(accountNumber, year)
+					fmt.Println("Net capital gains/losses for year " + strconv.Itoa(year) + " is: " + strconv.FormatInt(capitalGains, 10) + " after a change of: " + strconv.FormatInt(netChanges[year], 10))
+					if ordinaryGain := db.GetCapitalGainsBalanceDetailForYear(accountNumber, year).OrdinaryGain; ordinaryGain != 0 {
+						fmt.Println("Ordinary mark-to-market gains/losses for year " + strconv.Itoa(year) + " is: " + strconv.FormatInt(ordinaryGain, 10))
+					}
 				}
-				year := time.Now().UTC().Year()
-				netChange := matchOrders(transactions, db)
-				capitalGains := db.GetCapitalGainsBalanceForYear(accountNumber, year)
-				fmt.Println("Net capital gains/losses for year " + strconv.Itoa(year) + " is: " + strconv.FormatInt(capitalGains, 10) + " after a change of: " + strconv.FormatInt(netChange, 10))
 			}
 			if err := reader.CommitMessages(context.Background(), msg); err != nil {
 				log.Fatal(err)
@@ -111,106 +140,29 @@ func main() {
 	fmt.Println("Shutting down gracefully...")
 }
 
-// initializeTokens checks if Schwab auth tokens in config are still valid. If not, retrieve new ones.
-func initializeTokens(config *Properties.Config, tm *TokenManager.TokenManager) (*Endpoints.SchwabAPI, error) {
-	var schwabAPI *Endpoints.SchwabAPI
-
-	// Set tokens if available
-	if config.BearerToken != "" && config.RefreshToken != "" {
-		tm.SetAuthTokens(config.BearerToken, config.RefreshToken)
-		schwabAPI = Endpoints.NewSchwabAPI(tm.BearerToken)
-
-		if _, err := schwabAPI.GetAccountNumbers(); err != nil {
-			slog.Warn("Cached tokens are invalid, need to grab new ones.")
-			err = tm.RefreshTokens()
-			if err != nil {
-				tm.GetAuthTokens()
-			}
-			err := config.UpdateTokens(tm.BearerToken, tm.RefreshToken)
-			if err != nil {
-				return nil, err
-			}
-			schwabAPI = Endpoints.NewSchwabAPI(tm.BearerToken)
-		}
-	} else {
-		tm.GetAuthTokens()
-		schwabAPI = Endpoints.NewSchwabAPI(tm.BearerToken)
-		err := config.UpdateTokens(tm.BearerToken, tm.RefreshToken)
-		if err != nil {
-			return nil, err
-		}
+// recomputeAccount rebuilds the account's lots, ledger and balances from its transaction history and prints how each
+// tax year's balance changed
+func recomputeAccount(db *Data.DatabaseHelper, accountNumber int) {
+	changes, err := Matcher.RecomputeAccount(db, accountNumber)
+	if err != nil {
+		slog.Error("Recompute failed, the previous balances are kept", "error", err)
+		return
 	}
-
-	return schwabAPI, nil
-}
-
-// matchOrders takes in a list of transactions and matches any sells to buys (partial or fully) and updates the DB
-func matchOrders(transactions []Data.TransactionData, db *Data.DatabaseHelper) int64 {
-	tickerMap := make(map[string][]Data.TransactionData)
-	tickerGainsMap := make(map[string]int64)
-
-	// Populate the map
-	for _, transaction := range transactions {
-		tickerMap[transaction.StockTicker] = append(tickerMap[transaction.StockTicker], transaction)
+	fmt.Printf("Recomputed account %d, balances changed for %d tax year(s)\n", accountNumber, len(changes))
+	for _, change := range changes {
+		fmt.Println(change)
 	}
-
-	var netChange int64 = 0
-	var matchedActivityIds []int64
-	for ticker, transactionsForTicker := range tickerMap {
-		sort.Slice(transactionsForTicker, func(i, j int) bool {
-			return transactionsForTicker[i].ActivityDate.Before(transactionsForTicker[j].ActivityDate)
-		})
-
-		tickerGainsMap[ticker] = 0
-		buyQueue := []Data.TransactionData{}
-
-		for _, transaction := range transactionsForTicker {
-			if transaction.Matched == true {
-				continue
-			} else if transaction.OrderType == "BUY" {
-				// Add BUY transactions to the queue without adjusting gains
-				buyQueue = append(buyQueue, transaction)
-			} else if transaction.OrderType == "SELL" {
-				sharesToSell := transaction.ShareCount
-				var gain int64
-				// Process the sell by matching with buys in the queue
-				for sharesToSell > 0 && len(buyQueue) > 0 {
-					buy := &buyQueue[0] // Reference the first buy in the queue
-					if buy.ShareCount <= sharesToSell {
-						// Full match
-						gain = (transaction.StockPrice - buy.StockPrice) * int64(buy.ShareCount)
-						tickerGainsMap[ticker] += gain
-						sharesToSell -= buy.ShareCount
-						// Remove the buy from the queue as it is fully matched
-						buyQueue = buyQueue[1:]
-						additionalIDs := []int64{buy.ActivityId, transaction.ActivityId}
-						matchedActivityIds = append(matchedActivityIds, additionalIDs...)
-						capitalGainsBalance := float64(gain) / 100
-						log.Printf("Found new capital gain/loss for stock ticker: %s for $%.2f", ticker, capitalGainsBalance)
-						log.Println()
-					} else {
-						// Partial match
-						gain = (transaction.StockPrice - buy.StockPrice) * int64(sharesToSell)
-						tickerGainsMap[ticker] += gain
-						buy.ShareCount -= sharesToSell
-						sharesToSell = 0
-					}
-				}
-			}
-		}
-		netChange += tickerGainsMap[ticker]
-	}
-
-	db.MatchTransactions(transactions[0].AccountId, matchedActivityIds)
-	db.UpsertCapitalGainsBalance(transactions[0].AccountId, transactions[0].ActivityDate.Year(), netChange, 0)
-	return netChange
 }
 
-// containsSellOrder returns true if list of newly received orders contains any sell orders
-func containsSellOrder(orders []JsonParser.Order) bool {
+// containsClosingOrder returns true if list of newly received orders contains any orders with a leg that closes a
+// position, i.e. sells of long shares, buys to cover a short or option closing trades
+func containsClosingOrder(orders []JsonParser.Order) bool {
 	for _, order := range orders {
-		if order.OrderLegCollection[0].Instruction == "SELL" {
-			return true
+		for _, orderLeg := range order.OrderLegCollection {
+			switch orderLeg.Instruction {
+			case "SELL", "BUY_TO_COVER", "SELL_TO_CLOSE", "BUY_TO_CLOSE":
+				return true
+			}
 		}
 	}
 	return false
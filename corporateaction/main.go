@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gains/Data"
+	"gains/Matcher"
+	"gains/Properties"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// corporateaction records a corporate action such as a stock split, ticker change, merger or spin-off and applies it
+// to the lots of every account
+func main() {
+	actionType := flag.String("type", Matcher.SplitAction, "SPLIT, TICKER_CHANGE, MERGER, TAXABLE_MERGER or SPIN_OFF")
+	ticker := flag.String("ticker", "", "Stock ticker the action applies to")
+	cusip := flag.String("cusip", "", "CUSIP of the security the action applies to, if known")
+	date := flag.String("date", "", "Effective date, e.g. 2024-06-10")
+	splitFrom := flag.Int("from", 1, "Shares held before the action, e.g. 10 for a 1-for-10 reverse split")
+	splitTo := flag.Int("to", 1, "Shares received for them, e.g. 4 for a 4-for-1 split")
+	cashInLieu := flag.Float64("cash-in-lieu", 0, "Per share price paid for fractional shares, 0 to keep them")
+	newTicker := flag.String("new-ticker", "", "Ticker received in a ticker change, stock merger or spin-off")
+	newCusip := flag.String("new-cusip", "", "CUSIP of the security received, if known")
+	cash := flag.Float64("cash", 0, "Cash paid per share held in a cash or cash and stock merger")
+	newPrice := flag.Float64("new-price", 0,
+		"Fair market value of each new share received in a taxable or cash and stock merger")
+	allocation := flag.Float64("allocation", 0,
+		"Percent of the original basis allocated to the spun-off security, from the issuer's Form 8937")
+	flag.Parse()
+	if *ticker == "" || *date == "" {
+		log.Fatal("A ticker and effective date are required, e.g. -ticker NVDA -date 2024-06-10 -from 1 -to 10")
+	}
+	effectiveDate, err := time.Parse(time.DateOnly, *date)
+	if err != nil {
+		log.Fatalf("Invalid effective date: %v", err)
+	}
+
+	config, err := Properties.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	db, err := Data.NewDatabaseHelperFromConnectionString(config.DBConnectionString)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+
+	action, err := Matcher.RecordCorporateAction(db, Data.CorporateAction{
+		ActionType:      strings.ToUpper(*actionType),
+		StockTicker:     *ticker,
+		Cusip:           *cusip,
+		EffectiveDate:   effectiveDate,
+		SplitFrom:       *splitFrom,
+		SplitTo:         *splitTo,
+		CashInLieuPrice: int64(math.Round(*cashInLieu * 100)),
+		NewStockTicker:  *newTicker,
+		NewCusip:        *newCusip,
+		CashPerShare:    int64(math.Round(*cash * 100)),
+		BasisAllocation: int64(math.Round(*allocation * 10_000)),
+		NewStockPrice:   int64(math.Round(*newPrice * 100)),
+	})
+	if err != nil {
+		log.Fatalf("Recording corporate action failed: %v", err)
+	}
+	fmt.Printf("Recorded %s of %s effective %s as corporate action %d\n", action.ActionType, action.StockTicker,
+		action.EffectiveDate.Format(time.DateOnly), action.ActionId)
+}
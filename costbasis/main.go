@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gains/Data"
+	"gains/Matcher"
+	"gains/Properties"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// costbasis chooses the cost basis method of an account, of a security or asset type in it or of a single sale, or
+// designates the lots a sale is matched against under specific identification, then recomputes the account so every
+// realized gain follows the choice
+func main() {
+	accountId := flag.Int("account", 0, "Schwab account number")
+	method := flag.String("method", "", "FIFO, LIFO, HIFO, LOWEST_COST, SPECIFIC_ID or AVERAGE_COST")
+	sale := flag.Int64("sale", 0, "Activity id of a sell to override the method of instead of the account's")
+	security := flag.String("security", "", "Ticker or CUSIP to elect the method for instead of the account's")
+	assetType := flag.String("asset-type", "",
+		"Asset type to elect the method for instead of the account's, e.g. MUTUAL_FUND")
+	lots := flag.String("lots", "",
+		"Shares of each purchase the -sale sells, by the purchase's activity id, e.g. 1234567890=10,1234567891=2.5")
+	flag.Parse()
+	if *accountId == 0 {
+		log.Fatal("An account number is required, e.g. -account 12345678")
+	}
+	if *lots != "" && *sale == 0 {
+		log.Fatal("A sale is required with -lots, e.g. -sale 1234567899")
+	}
+	if (*security != "" || *assetType != "") && (*method == "" || *sale != 0 || *security != "" && *assetType != "") {
+		log.Fatal("-security or -asset-type takes a -method and can't be combined with each other or -sale")
+	}
+	costBasisMethod := strings.ToUpper(*method)
+	if *lots != "" && costBasisMethod == "" {
+		costBasisMethod = string(Matcher.SpecificId)
+	}
+	if costBasisMethod != "" && !Matcher.ValidCostBasisMethod(costBasisMethod) {
+		log.Fatalf("Unknown cost basis method %q", *method)
+	}
+
+	config, err := Properties.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	db, err := Data.NewDatabaseHelperFromConnectionString(config.DBConnectionString)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+
+	switch {
+	case *security != "" || *assetType != "":
+		election := Data.CostBasisElection{
+			AccountId:       *accountId,
+			Scope:           Matcher.SecurityScope,
+			ScopeValue:      strings.ToUpper(*security),
+			CostBasisMethod: costBasisMethod,
+		}
+		if *assetType != "" {
+			election.Scope, election.ScopeValue = Matcher.AssetTypeScope, strings.ToUpper(*assetType)
+		}
+		if err := db.SetCostBasisElection(election); err != nil {
+			log.Fatalf("Could not elect cost basis method: %v", err)
+		}
+		fmt.Printf("Elected %s for %s %s\n", costBasisMethod, strings.ToLower(election.Scope), election.ScopeValue)
+	case *sale != 0 && costBasisMethod != "":
+		if err := db.SetSaleCostBasisMethod(*accountId, *sale, costBasisMethod); err != nil {
+			log.Fatalf("Could not override cost basis method: %v", err)
+		}
+	case costBasisMethod != "":
+		if err := db.SetCostBasisMethod(*accountId, costBasisMethod); err != nil {
+			log.Fatalf("Could not set cost basis method: %v", err)
+		}
+	}
+	if *lots != "" {
+		for _, entry := range strings.Split(*lots, ",") {
+			activity, quantity, found := strings.Cut(entry, "=")
+			if !found {
+				log.Fatalf("Invalid lot selection %q, expected ACTIVITY_ID=QUANTITY", entry)
+			}
+			lotActivityId, err := strconv.ParseInt(strings.TrimSpace(activity), 10, 64)
+			if err != nil {
+				log.Fatalf("Invalid purchase activity id %q: %v", activity, err)
+			}
+			shares, err := Data.ParseQuantity(quantity)
+			if err != nil || shares <= 0 {
+				log.Fatalf("Invalid quantity %q for purchase %d", quantity, lotActivityId)
+			}
+			err = db.AddSpecificLotSelection(Data.LotSelection{
+				AccountId:      *accountId,
+				SellActivityId: *sale,
+				LotActivityId:  lotActivityId,
+				Quantity:       shares,
+			})
+			if err != nil {
+				log.Fatalf("Could not save lot selection: %v", err)
+			}
+		}
+	}
+
+	if _, err := Matcher.RecomputeAccount(db, *accountId); err != nil {
+		log.Fatalf("Recompute failed: %v", err)
+	}
+	accountMethod, err := db.GetCostBasisMethod(*accountId)
+	if err != nil {
+		log.Fatalf("Could not get cost basis method: %v", err)
+	}
+	fmt.Printf("Account %d matches sales with %s\n", *accountId, accountMethod)
+	if *sale != 0 {
+		gains, err := db.GetRealizedGainsBySellActivityID(*accountId, *sale)
+		if err != nil {
+			log.Fatalf("Could not get realized gains: %v", err)
+		}
+		for _, gain := range gains {
+			fmt.Printf("Sale %d: %s shares of lot %d with %s, %s gain $%.2f\n", *sale, gain.Quantity, gain.LotId,
+				gain.CostBasisMethod, gain.HoldingTerm, float64(gain.Gain)/100)
+		}
+	}
+}
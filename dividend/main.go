@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gains/Data"
+	"gains/Matcher"
+	"gains/Properties"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// dividend records a dividend paid to an account, opens a lot for any shares it bought through dividend reinvestment
+// and prints the account's qualified and ordinary dividend income for every tax year
+func main() {
+	accountId := flag.Int("account", 0, "Schwab account number")
+	ticker := flag.String("ticker", "", "Stock ticker that paid the dividend")
+	cusip := flag.String("cusip", "", "CUSIP of the security, if known")
+	date := flag.String("date", "", "Pay date, e.g. 2024-06-10")
+	amount := flag.Float64("amount", 0, "Dividend paid in dollars")
+	dividendType := flag.String("type", Matcher.QualifiedDividend, "QUALIFIED or ORDINARY")
+	shares := flag.Float64("shares", 0, "Shares bought by reinvesting the dividend, 0 if it was paid in cash")
+	price := flag.Float64("price", 0, "Per share price the dividend was reinvested at")
+	flag.Parse()
+	if *accountId == 0 || *ticker == "" || *date == "" {
+		log.Fatal("An account, ticker and pay date are required, e.g. -account 12345678 -ticker VTI -date 2024-06-10")
+	}
+	payDate, err := time.Parse(time.DateOnly, *date)
+	if err != nil {
+		log.Fatalf("Invalid pay date: %v", err)
+	}
+
+	config, err := Properties.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	db, err := Data.NewDatabaseHelperFromConnectionString(config.DBConnectionString)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+
+	dividend, err := Matcher.RecordDividend(db, Data.Dividend{
+		AccountId:          *accountId,
+		StockTicker:        *ticker,
+		Cusip:              *cusip,
+		PayDate:            payDate,
+		Amount:             int64(math.Round(*amount * 100)),
+		DividendType:       strings.ToUpper(*dividendType),
+		ReinvestedQuantity: Data.QuantityFromFloat(*shares),
+		ReinvestPrice:      int64(math.Round(*price * 100)),
+	})
+	if err != nil {
+		log.Fatalf("Recording dividend failed: %v", err)
+	}
+	fmt.Printf("Recorded %s dividend of %s as activity %d\n", dividend.DividendType, dividend.StockTicker,
+		dividend.ActivityId)
+
+	totals, err := db.GetDividendTotalsByAccountID(*accountId)
+	if err != nil {
+		log.Fatalf("Could not get dividend totals: %v", err)
+	}
+	for _, total := range totals {
+		fmt.Printf("Dividends for %d: $%.2f qualified, $%.2f ordinary\n", total.TaxYear,
+			float64(total.Qualified)/100, float64(total.Ordinary)/100)
+	}
+}
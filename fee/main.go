@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gains/Data"
+	"gains/Matcher"
+	"gains/Properties"
+	"log"
+	"math"
+	"strings"
+)
+
+// fee records a commission or regulatory fee charged on an execution that the transaction history is missing and
+// recomputes the account when the execution was already matched
+func main() {
+	accountId := flag.Int("account", 0, "Schwab account number")
+	activityId := flag.Int64("activity", 0, "Activity id of the execution the fee was charged on")
+	legId := flag.Int("leg", 1, "Execution leg the fee was charged on")
+	feeType := flag.String("type", "COMMISSION",
+		"COMMISSION, SEC_FEE, TAF_FEE, OPT_REG_FEE, INDEX_OPTION_FEE or OTHER")
+	amount := flag.Float64("amount", 0, "Fee in dollars, replaces any amount already recorded for the type")
+	flag.Parse()
+	if *accountId == 0 || *activityId == 0 {
+		log.Fatal("An account and activity are required, e.g. -account 12345678 -activity 987654321 -amount 0.65")
+	}
+
+	config, err := Properties.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	db, err := Data.NewDatabaseHelperFromConnectionString(config.DBConnectionString)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+
+	changes, err := Matcher.RecordTransactionFee(db, Data.TransactionFee{
+		AccountId:  *accountId,
+		ActivityId: *activityId,
+		LegId:      *legId,
+		FeeType:    strings.ToUpper(*feeType),
+		Amount:     int64(math.Round(*amount * 100)),
+	})
+	if err != nil {
+		log.Fatalf("Recording fee failed: %v", err)
+	}
+	fmt.Printf("Recorded %s of $%.2f on activity %d\n", strings.ToUpper(*feeType), *amount, *activityId)
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+}
@@ -43,3 +43,435 @@ END;
 $$;
 
 alter function upsertcapitalchangebalance(integer, integer, bigint, integer) owner to postgres;
+
+CREATE TABLE tax_lots (
+                          lot_id SERIAL PRIMARY KEY,
+                          account_id INT NOT NULL,
+                          activity_id BIGINT NOT NULL,
+                          stock_ticker VARCHAR(10) NOT NULL,
+                          original_quantity INT NOT NULL,
+                          open_quantity INT NOT NULL CHECK (open_quantity >= 0),
+                          cost_per_share BIGINT NOT NULL,
+                          acquisition_date TIMESTAMP NOT NULL,
+                          created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                          UNIQUE (account_id, activity_id)
+);
+
+CREATE INDEX tax_lots_open_idx ON tax_lots (account_id, stock_ticker) WHERE open_quantity > 0;
+
+CREATE TABLE account_info (
+                              account_id INT PRIMARY KEY,
+                              hash_id VARCHAR(128) NOT NULL,
+                              cost_basis_method VARCHAR(12) NOT NULL DEFAULT 'FIFO'
+                                  CHECK (cost_basis_method IN ('FIFO', 'LIFO', 'HIFO', 'LOWEST_COST', 'SPECIFIC_ID'))
+);
+
+CREATE TABLE sale_cost_basis_overrides (
+                                           account_id INT NOT NULL,
+                                           sell_activity_id BIGINT NOT NULL,
+                                           cost_basis_method VARCHAR(12) NOT NULL
+                                               CHECK (cost_basis_method IN ('FIFO', 'LIFO', 'HIFO', 'LOWEST_COST', 'SPECIFIC_ID')),
+                                           primary key (account_id, sell_activity_id)
+);
+
+CREATE TABLE specific_lot_selections (
+                                         account_id INT NOT NULL,
+                                         sell_activity_id BIGINT NOT NULL,
+                                         lot_id INT NOT NULL REFERENCES tax_lots (lot_id),
+                                         quantity INT NOT NULL CHECK (quantity > 0),
+                                         primary key (account_id, sell_activity_id, lot_id)
+);
+
+CREATE TABLE realized_gains (
+                                gain_id SERIAL PRIMARY KEY,
+                                account_id INT NOT NULL,
+                                sell_activity_id BIGINT NOT NULL,
+                                lot_id INT NOT NULL REFERENCES tax_lots (lot_id),
+                                quantity INT NOT NULL,
+                                gain BIGINT NOT NULL,
+                                cost_basis_method VARCHAR(12) NOT NULL,
+                                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE capital_gains_balance
+ADD COLUMN short_term_change BIGINT NOT NULL default 0,
+ADD COLUMN long_term_change BIGINT NOT NULL default 0;
+
+ALTER TABLE realized_gains
+ADD COLUMN holding_term VARCHAR(5) CHECK (holding_term IN ('SHORT', 'LONG')) NOT NULL default 'SHORT';
+
+create function upsertcapitalchangebalance(p_account_id integer, p_tax_year integer, p_short_term_change bigint, p_long_term_change bigint, p_carryover_loss integer) returns void
+    language plpgsql
+as
+$$
+BEGIN
+    -- Try to update the record
+    UPDATE capital_gains_balance
+    SET net_capital_change = net_capital_change + p_short_term_change + p_long_term_change,
+        short_term_change = short_term_change + p_short_term_change,
+        long_term_change = long_term_change + p_long_term_change
+    WHERE account_id = p_account_id AND tax_year = p_tax_year;
+
+    -- If no row was updated, insert a new record
+    IF NOT FOUND THEN
+        INSERT INTO capital_gains_balance (account_id, tax_year, net_capital_change, carryover_loss,
+                                           short_term_change, long_term_change)
+        VALUES (p_account_id, p_tax_year, p_short_term_change + p_long_term_change, p_carryover_loss,
+                p_short_term_change, p_long_term_change);
+    END IF;
+END;
+$$;
+
+alter function upsertcapitalchangebalance(integer, integer, bigint, bigint, integer) owner to postgres;
+
+ALTER TABLE tax_lots
+ADD COLUMN parent_lot_id INT REFERENCES tax_lots (lot_id),
+ADD COLUMN basis_adjustment BIGINT NOT NULL default 0,
+ADD COLUMN holding_period_start TIMESTAMP,
+ADD COLUMN wash_sale_replacement BOOLEAN NOT NULL default false;
+
+UPDATE tax_lots SET holding_period_start = acquisition_date;
+
+ALTER TABLE tax_lots
+ALTER COLUMN holding_period_start SET NOT NULL,
+DROP CONSTRAINT tax_lots_account_id_activity_id_key;
+
+-- Lots split off for wash sale replacement shares share the activity of the lot they came from
+CREATE UNIQUE INDEX tax_lots_activity_idx ON tax_lots (account_id, activity_id) WHERE parent_lot_id IS NULL;
+
+ALTER TABLE realized_gains
+ADD COLUMN stock_ticker VARCHAR(10) NOT NULL default '',
+ADD COLUMN sell_date TIMESTAMP,
+ADD COLUMN disallowed_loss BIGINT NOT NULL default 0,
+ADD COLUMN wash_sale_quantity INT NOT NULL default 0;
+
+ALTER TABLE realized_gains
+ADD COLUMN proceeds BIGINT NOT NULL default 0,
+ADD COLUMN cost_basis BIGINT NOT NULL default 0,
+ADD COLUMN basis_adjustment BIGINT NOT NULL default 0;
+
+CREATE INDEX realized_gains_sell_idx ON realized_gains (account_id, sell_activity_id);
+CREATE INDEX realized_gains_lot_idx ON realized_gains (lot_id);
+
+-- Lots are rebuilt with new ids when gains are recomputed, so specific lot selections point at the purchase instead
+ALTER TABLE specific_lot_selections
+ADD COLUMN lot_activity_id BIGINT;
+
+UPDATE specific_lot_selections s
+SET lot_activity_id = l.activity_id
+FROM tax_lots l
+WHERE l.lot_id = s.lot_id;
+
+ALTER TABLE specific_lot_selections
+DROP CONSTRAINT specific_lot_selections_pkey,
+DROP COLUMN lot_id,
+ALTER COLUMN lot_activity_id SET NOT NULL,
+ADD PRIMARY KEY (account_id, sell_activity_id, lot_activity_id);
+
+ALTER TABLE transaction_history
+DROP CONSTRAINT transaction_history_order_type_check,
+ALTER COLUMN order_type TYPE VARCHAR(12),
+ADD CONSTRAINT transaction_history_order_type_check CHECK (order_type IN ('BUY', 'SELL', 'SELL_SHORT', 'BUY_TO_COVER'));
+
+-- Short lots are opened by SELL_SHORT at the short sale price and closed by BUY_TO_COVER
+ALTER TABLE tax_lots
+ADD COLUMN position_side VARCHAR(5) CHECK (position_side IN ('LONG', 'SHORT')) NOT NULL default 'LONG';
+
+-- Options are tracked under their OCC symbol, e.g. 'AAPL  240119C00190000'
+ALTER TABLE transaction_history
+ALTER COLUMN stock_ticker TYPE VARCHAR(32),
+DROP CONSTRAINT transaction_history_order_type_check,
+ADD CONSTRAINT transaction_history_order_type_check CHECK (order_type IN ('BUY', 'SELL', 'SELL_SHORT', 'BUY_TO_COVER',
+                                                                           'BUY_TO_OPEN', 'SELL_TO_OPEN',
+                                                                           'BUY_TO_CLOSE', 'SELL_TO_CLOSE',
+                                                                           'EXPIRATION', 'EXERCISE', 'ASSIGNMENT'));
+
+ALTER TABLE tax_lots
+ALTER COLUMN stock_ticker TYPE VARCHAR(32),
+ADD COLUMN multiplier INT NOT NULL default 1;
+
+ALTER TABLE realized_gains
+ALTER COLUMN stock_ticker TYPE VARCHAR(32);
+
+-- Transactions entered by hand rather than received from Schwab get negative activity ids so they never collide
+CREATE SEQUENCE manual_activity_id_seq;
+
+-- Share counts carry fractional shares exactly to the millionth
+ALTER TABLE transaction_history
+ALTER COLUMN share_count TYPE NUMERIC(24,6);
+
+ALTER TABLE tax_lots
+ALTER COLUMN original_quantity TYPE NUMERIC(24,6),
+ALTER COLUMN open_quantity TYPE NUMERIC(24,6);
+
+ALTER TABLE specific_lot_selections
+ALTER COLUMN quantity TYPE NUMERIC(24,6);
+
+ALTER TABLE realized_gains
+ALTER COLUMN quantity TYPE NUMERIC(24,6),
+ALTER COLUMN wash_sale_quantity TYPE NUMERIC(24,6);
+
+-- Commissions and regulatory fees per execution, in cents
+CREATE TABLE transaction_fees (
+                                  account_id INT NOT NULL,
+                                  activity_id BIGINT NOT NULL,
+                                  fee_type VARCHAR(20) CHECK (fee_type IN ('COMMISSION', 'SEC_FEE', 'TAF_FEE',
+                                                                           'OPT_REG_FEE', 'INDEX_OPTION_FEE',
+                                                                           'OTHER')) NOT NULL,
+                                  amount BIGINT NOT NULL,
+                                  primary key (account_id, activity_id, fee_type)
+);
+
+CREATE TABLE corporate_actions (
+                                   action_id SERIAL PRIMARY KEY,
+                                   action_type VARCHAR(20) CHECK (action_type IN ('SPLIT')) NOT NULL,
+                                   stock_ticker VARCHAR(32) NOT NULL,
+                                   effective_date DATE NOT NULL,
+                                   split_from INT NOT NULL default 1 CHECK (split_from > 0),
+                                   split_to INT NOT NULL default 1 CHECK (split_to > 0),
+                                   cash_in_lieu_price BIGINT NOT NULL default 0,
+                                   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE applied_corporate_actions (
+                                           account_id INT NOT NULL,
+                                           action_id INT NOT NULL REFERENCES corporate_actions (action_id),
+                                           applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                           primary key (account_id, action_id)
+);
+
+ALTER TABLE realized_gains
+ADD COLUMN corporate_action_id INT REFERENCES corporate_actions (action_id);
+
+ALTER TABLE transaction_history
+ADD COLUMN cusip VARCHAR(9);
+
+ALTER TABLE tax_lots
+ADD COLUMN cusip VARCHAR(9);
+
+ALTER TABLE corporate_actions
+DROP CONSTRAINT corporate_actions_action_type_check,
+ADD CONSTRAINT corporate_actions_action_type_check CHECK (action_type IN ('SPLIT', 'TICKER_CHANGE', 'MERGER',
+                                                                          'SPIN_OFF')),
+ADD COLUMN cusip VARCHAR(9),
+ADD COLUMN new_stock_ticker VARCHAR(32),
+ADD COLUMN new_cusip VARCHAR(9),
+ADD COLUMN cash_per_share BIGINT NOT NULL default 0,
+ADD COLUMN basis_allocation INT NOT NULL default 0 CHECK (basis_allocation BETWEEN 0 AND 1000000);
+
+ALTER TABLE transaction_history
+ADD COLUMN leg_id INT NOT NULL default 1,
+ADD COLUMN asset_type VARCHAR(20),
+ADD COLUMN instrument_id BIGINT,
+ADD COLUMN position_effect VARCHAR(10),
+DROP CONSTRAINT transaction_history_pkey,
+ADD PRIMARY KEY (account_id, order_id, activity_id, leg_id);
+
+ALTER TABLE tax_lots
+ADD COLUMN leg_id INT NOT NULL default 1;
+
+DROP INDEX tax_lots_activity_idx;
+
+CREATE UNIQUE INDEX tax_lots_activity_idx ON tax_lots (account_id, activity_id, leg_id) WHERE parent_lot_id IS NULL;
+
+ALTER TABLE transaction_fees
+ADD COLUMN leg_id INT NOT NULL default 1,
+DROP CONSTRAINT transaction_fees_pkey,
+ADD PRIMARY KEY (account_id, activity_id, leg_id, fee_type);
+
+-- Rows recorded before the execution time was kept get the time they were recorded, which the consumer does as the
+-- orders fill
+ALTER TABLE transaction_history
+ADD COLUMN IF NOT EXISTS activity_date TIMESTAMP;
+
+UPDATE transaction_history
+SET activity_date = COALESCE(created_at, CURRENT_TIMESTAMP)
+WHERE activity_date IS NULL;
+
+ALTER TABLE transaction_history
+ALTER COLUMN activity_date SET NOT NULL;
+
+ALTER TABLE account_info
+ADD COLUMN filing_status VARCHAR(6) NOT NULL default 'SINGLE'
+    CHECK (filing_status IN ('SINGLE', 'MFJ', 'MFS', 'HOH', 'QSS'));
+
+ALTER TABLE capital_gains_balance
+ALTER COLUMN carryover_loss TYPE BIGINT,
+ADD COLUMN short_term_carryover BIGINT NOT NULL default 0,
+ADD COLUMN long_term_carryover BIGINT NOT NULL default 0,
+ADD COLUMN deducted_loss BIGINT NOT NULL default 0;
+
+CREATE TABLE taxable_income (
+                                account_id INT NOT NULL,
+                                tax_year INT NOT NULL,
+                                amount BIGINT NOT NULL,
+                                primary key (account_id, tax_year)
+);
+
+CREATE TABLE capital_loss_carryover_worksheets (
+                                                   account_id INT NOT NULL,
+                                                   tax_year INT NOT NULL,
+                                                   filing_status VARCHAR(6) NOT NULL,
+                                                   line_1 BIGINT,
+                                                   line_2 BIGINT NOT NULL,
+                                                   line_3 BIGINT NOT NULL,
+                                                   line_4 BIGINT NOT NULL,
+                                                   line_5 BIGINT NOT NULL,
+                                                   line_6 BIGINT NOT NULL,
+                                                   line_7 BIGINT NOT NULL,
+                                                   line_8 BIGINT NOT NULL,
+                                                   line_9 BIGINT NOT NULL,
+                                                   line_10 BIGINT NOT NULL,
+                                                   line_11 BIGINT NOT NULL,
+                                                   line_12 BIGINT NOT NULL,
+                                                   line_13 BIGINT NOT NULL,
+                                                   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                                   primary key (account_id, tax_year)
+);
+
+ALTER TABLE account_info
+DROP CONSTRAINT account_info_cost_basis_method_check,
+ADD CONSTRAINT account_info_cost_basis_method_check
+    CHECK (cost_basis_method IN ('FIFO', 'LIFO', 'HIFO', 'LOWEST_COST', 'SPECIFIC_ID', 'AVERAGE_COST'));
+
+ALTER TABLE sale_cost_basis_overrides
+DROP CONSTRAINT sale_cost_basis_overrides_cost_basis_method_check,
+ADD CONSTRAINT sale_cost_basis_overrides_cost_basis_method_check
+    CHECK (cost_basis_method IN ('FIFO', 'LIFO', 'HIFO', 'LOWEST_COST', 'SPECIFIC_ID', 'AVERAGE_COST'));
+
+CREATE TABLE cost_basis_method_elections (
+                                             account_id INT NOT NULL,
+                                             scope VARCHAR(10) CHECK (scope IN ('SECURITY', 'ASSET_TYPE')) NOT NULL,
+                                             scope_value VARCHAR(32) NOT NULL,
+                                             cost_basis_method VARCHAR(12) NOT NULL
+                                                 CHECK (cost_basis_method IN ('FIFO', 'LIFO', 'HIFO', 'LOWEST_COST',
+                                                                              'SPECIFIC_ID', 'AVERAGE_COST')),
+                                             primary key (account_id, scope, scope_value)
+);
+
+-- Dividends reinvested through DRIP buy shares as REINVEST transactions, opened as lots like any other buy
+ALTER TABLE transaction_history
+DROP CONSTRAINT transaction_history_order_type_check,
+ADD CONSTRAINT transaction_history_order_type_check CHECK (order_type IN ('BUY', 'SELL', 'SELL_SHORT', 'BUY_TO_COVER',
+                                                                           'BUY_TO_OPEN', 'SELL_TO_OPEN',
+                                                                           'BUY_TO_CLOSE', 'SELL_TO_CLOSE',
+                                                                           'EXPIRATION', 'EXERCISE', 'ASSIGNMENT',
+                                                                           'REINVEST'));
+
+CREATE TABLE dividends (
+                           account_id INT NOT NULL,
+                           activity_id BIGINT NOT NULL,
+                           stock_ticker VARCHAR(32) NOT NULL,
+                           cusip VARCHAR(9),
+                           pay_date TIMESTAMP NOT NULL,
+                           amount BIGINT NOT NULL,
+                           dividend_type VARCHAR(9) CHECK (dividend_type IN ('QUALIFIED', 'ORDINARY')) NOT NULL,
+                           reinvested_quantity NUMERIC(24,6) NOT NULL default 0,
+                           reinvest_price BIGINT NOT NULL default 0,
+                           created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                           primary key (account_id, activity_id)
+);
+
+-- Positions transferred in from another broker have no BUY to open their lots, so they are entered by hand and
+-- replayed as TRANSFER_IN transactions dated on the original acquisition date
+ALTER TABLE transaction_history
+DROP CONSTRAINT transaction_history_order_type_check,
+ADD CONSTRAINT transaction_history_order_type_check CHECK (order_type IN ('BUY', 'SELL', 'SELL_SHORT', 'BUY_TO_COVER',
+                                                                           'BUY_TO_OPEN', 'SELL_TO_OPEN',
+                                                                           'BUY_TO_CLOSE', 'SELL_TO_CLOSE',
+                                                                           'EXPIRATION', 'EXERCISE', 'ASSIGNMENT',
+                                                                           'REINVEST', 'TRANSFER_IN'));
+
+CREATE TABLE manual_lots (
+                             account_id INT NOT NULL,
+                             activity_id BIGINT NOT NULL,
+                             stock_ticker VARCHAR(32) NOT NULL,
+                             cusip VARCHAR(9),
+                             quantity NUMERIC(24,6) NOT NULL CHECK (quantity > 0),
+                             acquisition_date TIMESTAMP NOT NULL,
+                             total_basis BIGINT NOT NULL,
+                             basis_unknown BOOLEAN NOT NULL default false,
+                             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                             primary key (account_id, activity_id)
+);
+
+ALTER TABLE tax_lots
+ADD COLUMN basis_unknown BOOLEAN NOT NULL default false;
+
+ALTER TABLE realized_gains
+ADD COLUMN basis_unknown BOOLEAN NOT NULL default false;
+
+-- Gifted shares keep the donor's basis and holding period, with the fair market value on the date of the gift as the
+-- basis for losses when it was lower. Inherited shares take the fair market value on the date of death as their basis.
+ALTER TABLE manual_lots
+ADD COLUMN acquisition_type VARCHAR(11) NOT NULL default 'PURCHASE'
+    CHECK (acquisition_type IN ('PURCHASE', 'GIFT', 'INHERITANCE')),
+ADD COLUMN donor_acquisition_date TIMESTAMP,
+ADD COLUMN fair_market_value BIGINT NOT NULL default 0;
+
+ALTER TABLE tax_lots
+ADD COLUMN acquisition_type VARCHAR(11) NOT NULL default 'PURCHASE'
+    CHECK (acquisition_type IN ('PURCHASE', 'GIFT', 'INHERITANCE')),
+ADD COLUMN fair_market_value BIGINT NOT NULL default 0;
+
+-- Accounts with a Section 475(f) election mark their positions to market from the first tax year it covers. Their
+-- gains are ordinary rather than capital, wash sales don't apply and open positions are deemed sold and bought back
+-- at each year-end close.
+ALTER TABLE account_info
+ADD COLUMN mark_to_market_from INT;
+
+ALTER TABLE realized_gains
+DROP CONSTRAINT realized_gains_holding_term_check,
+ALTER COLUMN holding_term TYPE VARCHAR(8),
+ADD CONSTRAINT realized_gains_holding_term_check CHECK (holding_term IN ('SHORT', 'LONG', 'ORDINARY')),
+ADD COLUMN deemed_sale BOOLEAN NOT NULL default false;
+
+ALTER TABLE capital_gains_balance
+ADD COLUMN ordinary_gain BIGINT NOT NULL default 0;
+
+CREATE TABLE mark_to_market_years (
+                                      account_id INT NOT NULL,
+                                      tax_year INT NOT NULL,
+                                      created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                      primary key (account_id, tax_year)
+);
+
+CREATE TABLE price_history (
+                               symbol VARCHAR(32) NOT NULL,
+                               price_date DATE NOT NULL,
+                               close_price BIGINT NOT NULL,
+                               created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                               primary key (symbol, price_date)
+);
+
+-- Capital gains imported from 1099s don't come from transaction_history, so they are kept apart from the balances the
+-- matcher derives and added back whenever an account is recomputed.
+CREATE TABLE imported_capital_gains (
+                                        account_id INT NOT NULL,
+                                        tax_year INT NOT NULL,
+                                        short_term_change BIGINT NOT NULL default 0,
+                                        long_term_change BIGINT NOT NULL default 0,
+                                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                        primary key (account_id, tax_year)
+);
+
+-- A MERGER is a reorganization, whose cash is only taxed up to the gain the exchange realizes. A TAXABLE_MERGER sells
+-- the old shares for the cash and the new stock at its fair market value.
+ALTER TABLE corporate_actions
+DROP CONSTRAINT corporate_actions_action_type_check,
+ADD CONSTRAINT corporate_actions_action_type_check CHECK (action_type IN ('SPLIT', 'TICKER_CHANGE', 'MERGER',
+                                                                          'TAXABLE_MERGER', 'SPIN_OFF')),
+ADD COLUMN new_stock_price BIGINT NOT NULL default 0;
+
+-- Activity ids from the transactions endpoint and order ids overflow INT
+ALTER TABLE transaction_history
+ALTER COLUMN order_id TYPE BIGINT,
+ALTER COLUMN activity_id TYPE BIGINT;
+
+-- Weekdays a symbol had no session, e.g. market holidays, found when its closes were fetched
+CREATE TABLE no_trading_days (
+                                 symbol VARCHAR(32) NOT NULL,
+                                 trade_date DATE NOT NULL,
+                                 created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                 primary key (symbol, trade_date)
+);
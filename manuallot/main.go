@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gains/Data"
+	"gains/Matcher"
+	"gains/Properties"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// manuallot enters lots by hand for positions transferred in from another broker, either one from flags or many from
+// a CSV, and matches the account against them
+func main() {
+	accountId := flag.Int("account", 0, "Schwab account number")
+	csvPath := flag.String("csv", "", "CSV of lots with columns "+
+		"ticker,cusip,quantity,acquisition_date,total_basis,basis_unknown[,acquisition_type,donor_acquisition_date,"+
+		"fair_market_value]")
+	ticker := flag.String("ticker", "", "Stock ticker of the lot")
+	cusip := flag.String("cusip", "", "CUSIP of the security, if known")
+	quantity := flag.String("quantity", "", "Shares in the lot, e.g. 12.5")
+	date := flag.String("date", "", "Original acquisition date, e.g. 2019-03-14")
+	basis := flag.Float64("basis", 0, "Total cost basis of the lot in dollars")
+	basisUnknown := flag.Bool("basis-unknown", false, "The transferring broker did not report the basis")
+	acquisitionType := flag.String("acquisition-type", Matcher.PurchaseAcquisition,
+		"PURCHASE, GIFT, or INHERITANCE with -date the date of death and -basis the value on it")
+	donorDate := flag.String("donor-date", "", "Date the donor acquired gifted shares")
+	giftValue := flag.Float64("gift-value", 0, "Fair market value in dollars of gifted shares on the date of the gift")
+	flag.Parse()
+	if *accountId == 0 {
+		log.Fatal("An account number is required, e.g. -account 12345678")
+	}
+
+	var lots []Data.ManualLot
+	if *csvPath != "" {
+		file, err := os.Open(*csvPath)
+		if err != nil {
+			log.Fatalf("Could not open CSV: %v", err)
+		}
+		lots, err = Matcher.ParseManualLotsCSV(file, *accountId)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Could not read CSV: %v", err)
+		}
+	} else {
+		if *ticker == "" || *quantity == "" || *date == "" {
+			log.Fatal("A ticker, quantity and acquisition date are required, " +
+				"e.g. -ticker VTI -quantity 12.5 -date 2019-03-14 -basis 1843.75")
+		}
+		shares, err := Data.ParseQuantity(*quantity)
+		if err != nil {
+			log.Fatalf("Invalid quantity: %v", err)
+		}
+		acquisitionDate, err := time.Parse(time.DateOnly, *date)
+		if err != nil {
+			log.Fatalf("Invalid acquisition date: %v", err)
+		}
+		var donorAcquisitionDate time.Time
+		if *donorDate != "" {
+			if donorAcquisitionDate, err = time.Parse(time.DateOnly, *donorDate); err != nil {
+				log.Fatalf("Invalid donor acquisition date: %v", err)
+			}
+		}
+		lots = append(lots, Data.ManualLot{
+			AccountId:            *accountId,
+			StockTicker:          strings.ToUpper(*ticker),
+			Cusip:                strings.ToUpper(*cusip),
+			Quantity:             shares,
+			AcquisitionDate:      acquisitionDate,
+			TotalBasis:           int64(math.Round(*basis * 100)),
+			BasisUnknown:         *basisUnknown,
+			AcquisitionType:      strings.ToUpper(*acquisitionType),
+			DonorAcquisitionDate: donorAcquisitionDate,
+			FairMarketValue:      int64(math.Round(*giftValue * 100)),
+		})
+	}
+
+	config, err := Properties.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	db, err := Data.NewDatabaseHelperFromConnectionString(config.DBConnectionString)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+
+	recorded, err := Matcher.RecordManualLots(db, lots)
+	if err != nil {
+		log.Fatalf("Recording manual lots failed: %v", err)
+	}
+	for _, lot := range recorded {
+		basis := fmt.Sprintf("$%.2f", float64(lot.TotalBasis)/100)
+		if lot.BasisUnknown {
+			basis = "unknown basis"
+		}
+		fmt.Printf("Recorded %s shares of %s acquired by %s %s with %s as activity %d\n", lot.Quantity,
+			lot.StockTicker, strings.ToLower(lot.AcquisitionType), lot.AcquisitionDate.Format(time.DateOnly), basis,
+			lot.ActivityId)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gains/Data"
+	"gains/Endpoints"
+	"gains/Matcher"
+	"gains/Properties"
+	"gains/TokenManager"
+	"log"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// marktomarket records an account's Section 475(f) mark-to-market election and the closing prices its year-end deemed
+// sales use, recomputes the account and prints its ordinary and capital gains for every tax year
+func main() {
+	accountId := flag.Int("account", 0, "Schwab account number")
+	fromYear := flag.Int("from", 0, "First tax year the mark-to-market election covers")
+	revoke := flag.Bool("revoke", false, "Remove the account's mark-to-market election")
+	date := flag.String("date", "", "Trading day of the closing prices, e.g. 2024-12-31")
+	prices := flag.String("prices", "", "Closing prices on -date, e.g. AAPL=250.42,MSFT=421.50")
+	fetchPrices := flag.Bool("fetch-prices", false,
+		"Fetch the year-end closing prices of the account's tickers from Schwab")
+	flag.Parse()
+	if *accountId == 0 {
+		log.Fatal("An account number is required, e.g. -account 12345678")
+	}
+
+	config, err := Properties.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	Endpoints.ConfigureRetries(config)
+	db, err := Data.NewDatabaseHelperFromConnectionString(config.DBConnectionString)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+
+	if *fromYear != 0 || *revoke {
+		if *revoke {
+			*fromYear = 0
+		}
+		if err := db.SetMarkToMarketFrom(*accountId, *fromYear); err != nil {
+			log.Fatalf("Could not set mark-to-market election: %v", err)
+		}
+	}
+	if *prices != "" {
+		if *date == "" {
+			log.Fatal("A date is required with -prices, e.g. -date 2024-12-31")
+		}
+		priceDate, err := time.Parse(time.DateOnly, *date)
+		if err != nil {
+			log.Fatalf("Invalid price date: %v", err)
+		}
+		for _, entry := range strings.Split(*prices, ",") {
+			symbol, price, found := strings.Cut(entry, "=")
+			if !found {
+				log.Fatalf("Invalid closing price %q, expected SYMBOL=PRICE", entry)
+			}
+			dollars, err := strconv.ParseFloat(strings.TrimSpace(price), 64)
+			if err != nil {
+				log.Fatalf("Invalid closing price for %s: %v", symbol, err)
+			}
+			symbol = strings.ToUpper(strings.TrimSpace(symbol))
+			if err := db.SetClosingPrice(symbol, priceDate, int64(math.Round(dollars*100))); err != nil {
+				log.Fatalf("Could not record closing price: %v", err)
+			}
+		}
+	}
+
+	if *fetchPrices {
+		tm := TokenManager.NewTokenManager(config.AppKey, config.AppSecret)
+		schwabAPI, err := Endpoints.InitializeTokens(config, tm)
+		if err != nil {
+			log.Fatalf("Failed to initialize tokens: %v", err)
+		}
+		if err := fetchYearEndPrices(db, Endpoints.NewPriceHistory(schwabAPI, db), *accountId); err != nil {
+			log.Fatalf("Could not fetch closing prices: %v", err)
+		}
+	}
+
+	if _, err := Matcher.RecomputeAccount(db, *accountId); err != nil {
+		log.Fatalf("Recompute failed: %v", err)
+	}
+	balances, err := db.GetCapitalGainsBalancesByAccountID(*accountId)
+	if err != nil {
+		log.Fatalf("Could not get balances: %v", err)
+	}
+	from, err := db.GetMarkToMarketFrom(*accountId)
+	if err != nil {
+		log.Fatalf("Could not get mark-to-market election: %v", err)
+	}
+	if from != 0 {
+		fmt.Printf("Account %d marks to market from %d\n", *accountId, from)
+	} else {
+		fmt.Printf("Account %d has no mark-to-market election\n", *accountId)
+	}
+	for _, balance := range balances {
+		fmt.Printf("%d  ordinary $%.2f  capital $%.2f\n", balance.TaxYear, float64(balance.OrdinaryGain)/100,
+			float64(balance.NetCapitalChange)/100)
+	}
+}
+
+// fetchYearEndPrices looks up the closing price on December 31st of every ticker the account traded by then, for each
+// completed year its election covers. Tickers Schwab has no daily prices for, such as options, are logged and skipped.
+func fetchYearEndPrices(db *Data.DatabaseHelper, history *Endpoints.PriceHistory, accountId int) error {
+	fromYear, err := db.GetMarkToMarketFrom(accountId)
+	if err != nil || fromYear == 0 {
+		return err
+	}
+	transactions, err := db.GetTransactionsByAccountID(accountId)
+	if err != nil {
+		return err
+	}
+	for taxYear := fromYear; taxYear < time.Now().Year(); taxYear++ {
+		yearEnd := time.Date(taxYear, time.December, 31, 0, 0, 0, 0, time.UTC)
+		fetched := make(map[string]bool)
+		for _, transaction := range transactions {
+			ticker := transaction.StockTicker
+			if fetched[ticker] || transaction.ActivityDate.After(yearEnd.AddDate(0, 0, 1)) {
+				continue
+			}
+			fetched[ticker] = true
+			closePrice, priceDate, err := history.PriceOnDate(ticker, yearEnd)
+			var apiErr *Endpoints.ApiError
+			if errors.Is(err, Endpoints.ErrNoClosingPrice) || errors.As(err, &apiErr) {
+				slog.Warn("No year-end closing price", "ticker", ticker, "taxYear", taxYear, "error", err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s closed at $%.2f on %s\n", ticker, float64(closePrice)/100, priceDate.Format(time.DateOnly))
+		}
+	}
+	return nil
+}
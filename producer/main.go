@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"gains/Data/JsonParser"
 	"gains/Endpoints"
 	"gains/Properties"
 	"gains/TokenManager"
@@ -10,6 +12,7 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -21,6 +24,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Could not load config: %v", err)
 	}
+	Endpoints.ConfigureRetries(config)
 	tm := TokenManager.NewTokenManager(config.AppKey, config.AppSecret)
 
 	conn, err := kafka.DialLeader(ctx, "tcp", "localhost:9092", "my-topic", 0)
@@ -30,9 +34,9 @@ func main() {
 
 	defer conn.Close()
 
-	schwabAPI, err := initializeTokens(config, tm)
+	schwabAPI, err := Endpoints.InitializeTokens(config, tm)
 	if err != nil {
-		slog.Error("Failed to initialize tokens:", err)
+		slog.Error("Failed to initialize tokens", "error", err)
 	}
 	accountNumbers, _ := schwabAPI.GetAccountNumbers()
 
@@ -40,13 +44,32 @@ func main() {
 	go func() {
 		for {
 			fmt.Println(time.Now().String())
-			orders, err := schwabAPI.GetRecentOrders(accountNumbers.HashValue)
-			if err != nil {
-				slog.Error("Failed to get recent orders:", err)
-			} else {
-				_, err = conn.WriteMessages(kafka.Message{
-					Value: orders,
+			if config.ReadsOrders() {
+				orders, err := schwabAPI.GetRecentOrders(accountNumbers.HashValue)
+				if err != nil {
+					logRequestError("Failed to get recent orders", err)
+				} else {
+					_, err = conn.WriteMessages(kafka.Message{
+						Value: orders,
+					})
+				}
+			}
+			// Transactions can post well after the activity, so a day is polled and the consumer skips repeats
+			if config.ReadsTransactions() {
+				transactions, err := schwabAPI.GetTransactionsApi(accountNumbers.HashValue, map[string]string{
+					"startDate": time.Now().UTC().Add(-24 * time.Hour).Format("2006-01-02T15:04:05.000Z"),
+					"endDate":   time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+					"types": strings.Join([]string{JsonParser.TradeTransaction, JsonParser.DividendOrInterestTransaction,
+						JsonParser.ReceiveAndDeliverTransaction, JsonParser.JournalTransaction}, ","),
 				})
+				if err != nil {
+					logRequestError("Failed to get recent transactions", err)
+				} else {
+					_, err = conn.WriteMessages(kafka.Message{
+						Key:   []byte(Properties.TransactionsSource),
+						Value: transactions,
+					})
+				}
 			}
 			time.Sleep(60 * time.Second)
 		}
@@ -65,35 +88,11 @@ func main() {
 	fmt.Println("Shutting down gracefully...")
 }
 
-// initializeTokens checks if Schwab auth tokens in config are still valid. If not, retrieve new ones.
-func initializeTokens(config *Properties.Config, tm *TokenManager.TokenManager) (*Endpoints.SchwabAPI, error) {
-	var schwabAPI *Endpoints.SchwabAPI
-
-	// Set tokens if available
-	if config.BearerToken != "" && config.RefreshToken != "" {
-		tm.SetAuthTokens(config.BearerToken, config.RefreshToken)
-		schwabAPI = Endpoints.NewSchwabAPI(tm.BearerToken)
-
-		if _, err := schwabAPI.GetAccountNumbers(); err != nil {
-			slog.Warn("Cached tokens are invalid, need to grab new ones.")
-			err = tm.RefreshTokens()
-			if err != nil {
-				tm.GetAuthTokens()
-			}
-			err := config.UpdateTokens(tm.BearerToken, tm.RefreshToken)
-			if err != nil {
-				return nil, err
-			}
-			schwabAPI = Endpoints.NewSchwabAPI(tm.BearerToken)
-		}
-	} else {
-		tm.GetAuthTokens()
-		schwabAPI = Endpoints.NewSchwabAPI(tm.BearerToken)
-		err := config.UpdateTokens(tm.BearerToken, tm.RefreshToken)
-		if err != nil {
-			return nil, err
-		}
+// logRequestError logs a failed poll of Schwab. While the circuit breaker is open the outage has already been logged
+// once, so the polls it turns away are not.
+func logRequestError(message string, err error) {
+	if errors.Is(err, Endpoints.ErrCircuitOpen) {
+		return
 	}
-
-	return schwabAPI, nil
+	slog.Error(message, "error", err)
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gains/Data"
+	"gains/Matcher"
+	"gains/Properties"
+	"log"
+)
+
+// recompute rebuilds the tax lots, realized gains ledger and capital gains balances of an account from its
+// transaction history and prints how each tax year's balance changed
+func main() {
+	accountId := flag.Int("account", 0, "Schwab account number to recompute")
+	flag.Parse()
+	if *accountId == 0 {
+		log.Fatal("An account number is required, e.g. -account 12345678")
+	}
+
+	config, err := Properties.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	db, err := Data.NewDatabaseHelperFromConnectionString(config.DBConnectionString)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+
+	changes, err := Matcher.RecomputeAccount(db, *accountId)
+	if err != nil {
+		log.Fatalf("Recompute failed: %v", err)
+	}
+	if len(changes) == 0 {
+		fmt.Printf("Recomputed account %d, no balances changed\n", *accountId)
+		return
+	}
+
+	fmt.Printf("Recomputed account %d, balances changed for %d tax year(s):\n", *accountId, len(changes))
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"gains/Data"
+	"gains/Endpoints"
+	"gains/Matcher"
+	"gains/Properties"
+	"gains/TokenManager"
+	"log"
+)
+
+// reconcile compares the positions Schwab reports for the account against its open lots and prints every missing or
+// extra lot and every position whose basis drifted, so missed orders and corporate actions are caught before tax
+// season
+func main() {
+	config, err := Properties.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	Endpoints.ConfigureRetries(config)
+	tm := TokenManager.NewTokenManager(config.AppKey, config.AppSecret)
+	schwabAPI, err := Endpoints.InitializeTokens(config, tm)
+	if err != nil {
+		log.Fatalf("Failed to initialize tokens: %v", err)
+	}
+	accountNumbers, err := schwabAPI.GetAccountNumbers()
+	if err != nil {
+		log.Fatalf("Could not get account numbers: %v", err)
+	}
+	db, err := Data.NewDatabaseHelperFromConnectionString(config.DBConnectionString)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+
+	positions, err := schwabAPI.GetPositions(accountNumbers.HashValue)
+	if err != nil {
+		log.Fatalf("Could not get positions: %v", err)
+	}
+	differences, err := Matcher.ReconcilePositions(db, accountNumbers.AccountNumber, positions)
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+	if len(differences) == 0 {
+		fmt.Printf("Open lots of account %d agree with Schwab's %d position(s)\n", accountNumbers.AccountNumber,
+			len(positions))
+		return
+	}
+	fmt.Printf("Open lots of account %d differ from Schwab in %d place(s):\n", accountNumbers.AccountNumber,
+		len(differences))
+	for _, difference := range differences {
+		fmt.Println(difference)
+	}
+}
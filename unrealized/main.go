@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"gains/Data"
+	"gains/Endpoints"
+	"gains/Matcher"
+	"gains/Properties"
+	"gains/TokenManager"
+	"log"
+	"strings"
+	"time"
+)
+
+// unrealized quotes the tickers of the account's open lots and prints what selling every lot now would realize, per
+// lot and in short and long term totals
+func main() {
+	config, err := Properties.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Could not load config: %v", err)
+	}
+	Endpoints.ConfigureRetries(config)
+	tm := TokenManager.NewTokenManager(config.AppKey, config.AppSecret)
+	schwabAPI, err := Endpoints.InitializeTokens(config, tm)
+	if err != nil {
+		log.Fatalf("Failed to initialize tokens: %v", err)
+	}
+	accountNumbers, err := schwabAPI.GetAccountNumbers()
+	if err != nil {
+		log.Fatalf("Could not get account numbers: %v", err)
+	}
+	db, err := Data.NewDatabaseHelperFromConnectionString(config.DBConnectionString)
+	if err != nil {
+		log.Fatalf("Could not connect to database: %v", err)
+	}
+
+	lots, err := db.GetOpenTaxLotsByAccountID(accountNumbers.AccountNumber)
+	if err != nil {
+		log.Fatalf("Could not get open lots: %v", err)
+	}
+	var tickers []string
+	for _, lot := range lots {
+		tickers = append(tickers, lot.StockTicker)
+	}
+	quotes, err := schwabAPI.GetQuotes(tickers...)
+	if err != nil {
+		log.Fatalf("Could not get quotes: %v", err)
+	}
+	gains, err := Matcher.ComputeUnrealizedGains(db, accountNumbers.AccountNumber, quotes, time.Now())
+	if err != nil {
+		log.Fatalf("Computing unrealized gains failed: %v", err)
+	}
+
+	for _, gain := range gains.Lots {
+		fmt.Printf("Lot %d %s %s %s acquired %s: value $%.2f, basis $%.2f, %s gain $%.2f\n", gain.Lot.LotId,
+			gain.Lot.PositionSide, gain.Lot.OpenQuantity, gain.Lot.StockTicker,
+			gain.Lot.AcquisitionDate.Format(time.DateOnly), float64(gain.MarketValue)/100,
+			float64(gain.CostBasis)/100, gain.HoldingTerm, float64(gain.Gain)/100)
+	}
+	fmt.Printf("Unrealized gains of account %d: short term $%.2f, long term $%.2f\n", gains.AccountId,
+		float64(gains.ShortTerm)/100, float64(gains.LongTerm)/100)
+	if gains.Ordinary != 0 {
+		fmt.Printf("Unrealized ordinary gain marked to market at year end: $%.2f\n", float64(gains.Ordinary)/100)
+	}
+	if len(gains.Unquoted) > 0 {
+		fmt.Printf("No quote for %s, left out of the totals\n", strings.Join(gains.Unquoted, ", "))
+	}
+}